@@ -5,7 +5,11 @@
 package v1alpha1
 
 import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
@@ -19,6 +23,260 @@ type PoolSpec struct {
 	Concurrency   int              `json:"concurrency,omitempty"`
 	FailurePolicy string           `json:"onFailure,omitempty"`
 	CheckInterval *metav1.Duration `json:"checkInterval,omitempty"`
+	Tags          *TagListing      `json:"tags,omitempty"`
+	Source        *VersionSource   `json:"source,omitempty"`
+	Verification  *Verification    `json:"verification,omitempty"`
+	HealthChecks  *HealthChecks    `json:"healthChecks,omitempty"`
+	Timeouts      *Timeouts        `json:"timeouts,omitempty"`
+	Topology      *Topology        `json:"topology,omitempty"`
+	// MaxFailures is the number, or percentage, of nodes that may fail to
+	// upgrade in a run before no further nodes are started. By default,
+	// failures do not stop the run.
+	MaxFailures *intstr.IntOrString `json:"maxFailures,omitempty"`
+	// Upgrade are the options passed to the Talos API when requesting each
+	// node's upgrade.
+	Upgrade *UpgradeOptions `json:"upgrade,omitempty"`
+	// PreUpgrade and PostUpgrade are Jobs run before each node's upgrade is
+	// requested, and after it is healthy.
+	PreUpgrade  *Hook `json:"preUpgrade,omitempty"`
+	PostUpgrade *Hook `json:"postUpgrade,omitempty"`
+	// Strategy selects the policy that decides which nodes are upgraded
+	// next. It is one of Serial, Concurrent (the default) or Topology, or the
+	// name of a policy registered by the controller.
+	Strategy string `json:"strategy,omitempty"`
+	// Notifications are the webhooks notified of the pool's rollouts.
+	Notifications []Notification `json:"notifications,omitempty"`
+}
+
+const (
+	// SerialStrategy upgrades one node at a time.
+	SerialStrategy = "Serial"
+	// ConcurrentStrategy upgrades up to concurrency nodes at a time.
+	ConcurrentStrategy = "Concurrent"
+	// TopologyStrategy upgrades up to concurrency nodes at a time, from one
+	// topology group at a time.
+	TopologyStrategy = "Topology"
+)
+
+// DefaultRebootMode reboots the node with kexec, if it is supported. It is
+// the only reboot mode of the machine API.
+const DefaultRebootMode = "Default"
+
+// UpgradeOptions are the options of the Talos API's upgrade request. Nodes
+// running a Talos version that does not support an option fail with the
+// UnsupportedOption reason.
+type UpgradeOptions struct {
+	// Preserve keeps the node's ephemeral partition. It requires Talos v0.5.
+	Preserve bool `json:"preserve,omitempty"`
+	// Stage stages the upgrade, so that it is applied when the node reboots
+	// instead of while files are in use. It requires Talos v0.8.
+	Stage bool `json:"stage,omitempty"`
+	// Force skips Talos' own etcd checks when upgrading control plane nodes.
+	// It requires Talos v0.9.
+	Force bool `json:"force,omitempty"`
+	// ForfeitEtcdLeadership moves etcd leadership off each control plane
+	// node before its upgrade is requested.
+	ForfeitEtcdLeadership bool `json:"forfeitEtcdLeadership,omitempty"`
+	// RebootMode is Default. Other modes, such as a power cycle, are
+	// accepted once the machine API supports them.
+	// +kubebuilder:validation:Enum=Default
+	RebootMode string `json:"rebootMode,omitempty"`
+}
+
+// Hook runs a Job for each node, created from the job template of a
+// CronJob. A CronJob is used because it is the only built-in object holding a
+// Job template without running it, and it should be suspended so that it is
+// only used as a template. The Jobs of each node's last 3 attempts are kept.
+// POOL_NAME, NODE_NAME, PREVIOUS_VERSION and TARGET_VERSION are set
+// in every container. A Job that fails, or does not complete within the
+// timeout, fails the node's upgrade.
+type Hook struct {
+	// Namespace is the namespace of the CronJob, and of the Jobs created
+	// from it.
+	Namespace string `json:"namespace"`
+	// CronJob is the name of the CronJob.
+	CronJob string `json:"cronJob"`
+	// Timeout defaults to 15 minutes.
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// Topology groups the pool's nodes by failure domain. One group is upgraded
+// at a time, in the order of the label's values.
+type Topology struct {
+	// Key is the label that nodes are grouped by (e.g.
+	// topology.kubernetes.io/zone). Nodes without the label are upgraded
+	// last.
+	Key string `json:"key"`
+	// Pause is how long to wait between groups.
+	Pause *metav1.Duration `json:"pause,omitempty"`
+}
+
+// Timeouts bounds each phase of a node's upgrade.
+type Timeouts struct {
+	// Request bounds each request made to the Talos API. Defaults to 30s.
+	Request *metav1.Duration `json:"request,omitempty"`
+	// Reboot bounds the time the node may be unreachable after the upgrade
+	// is requested. Defaults to 10m.
+	Reboot *metav1.Duration `json:"reboot,omitempty"`
+	// VersionConvergence bounds the time between requesting the upgrade and
+	// the node reporting the target version. Defaults to 15m.
+	VersionConvergence *metav1.Duration `json:"versionConvergence,omitempty"`
+	// Stability is how long the node must pass its health checks before the
+	// upgrade is successful. Defaults to 30s.
+	Stability *metav1.Duration `json:"stability,omitempty"`
+}
+
+const (
+	// GenericFormat posts the event as JSON.
+	GenericFormat = "Generic"
+	// SlackFormat posts the event's message to a Slack incoming webhook.
+	SlackFormat = "Slack"
+	// AlertmanagerFormat posts the event as an alert to the Alertmanager
+	// API.
+	AlertmanagerFormat = "Alertmanager"
+)
+
+const (
+	// RolloutStartedEvent is notified when the first node's upgrade to a
+	// version is requested.
+	RolloutStartedEvent = "RolloutStarted"
+	// RolloutFinishedEvent is notified when every node has been upgraded to
+	// the version, or failed to.
+	RolloutFinishedEvent = "RolloutFinished"
+	// RolloutPausedEvent is notified when a node fails to upgrade with
+	// onFailure: Pause.
+	RolloutPausedEvent = "RolloutPaused"
+	// VersionResolvedEvent is notified when the version the pool is
+	// upgraded to changes.
+	VersionResolvedEvent = "VersionResolved"
+)
+
+// Notification is a webhook that is sent a POST request for the pool's
+// rollout events. Failed deliveries are retried with a backoff.
+type Notification struct {
+	Name string `json:"name"`
+	// URL is the webhook's URL.
+	URL string `json:"url,omitempty"`
+	// URLFrom selects the key of a Secret in the controller's namespace that
+	// holds the webhook's URL, instead of URL.
+	URLFrom *corev1.SecretKeySelector `json:"urlFrom,omitempty"`
+	// Format is one of Generic (the default), Slack or Alertmanager.
+	// +kubebuilder:validation:Enum=Generic;Slack;Alertmanager
+	Format string `json:"format,omitempty"`
+	// Template is a Go template rendered with the event. It is the body of
+	// Generic notifications, and the message of Slack and Alertmanager ones.
+	Template string `json:"template,omitempty"`
+	// Events are the events notified, one of RolloutStarted,
+	// RolloutFinished, RolloutPaused or VersionResolved. All of them are
+	// notified if empty.
+	Events []string `json:"events,omitempty"`
+}
+
+// HealthChecks defines the gates that an upgraded node must pass, in addition
+// to being Ready, before its upgrade is considered successful. A gate that
+// does not pass within its timeout, measured from when the node started
+// running the target version, fails the node's upgrade.
+type HealthChecks struct {
+	// Services requires Talos services (e.g. etcd, kubelet, apid) to be
+	// healthy.
+	Services *ServicesCheck `json:"services,omitempty"`
+	// DaemonSets requires the DaemonSet pods on the node to be running and
+	// ready.
+	DaemonSets *HealthGate `json:"daemonSets,omitempty"`
+	// Etcd requires every etcd member to be healthy. It only applies to
+	// control plane nodes.
+	Etcd *HealthGate `json:"etcd,omitempty"`
+	// Custom are user defined checks.
+	Custom []CustomCheck `json:"custom,omitempty"`
+}
+
+// HealthGate is a gate without options.
+type HealthGate struct {
+	// Timeout defaults to 15 minutes.
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// ServicesCheck defines the Talos services that must be healthy.
+type ServicesCheck struct {
+	Names []string `json:"names"`
+	// Timeout defaults to 15 minutes.
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// CustomCheck is either an HTTP probe or a pod readiness check.
+type CustomCheck struct {
+	Name string     `json:"name"`
+	HTTP *HTTPCheck `json:"http,omitempty"`
+	Pod  *PodCheck  `json:"pod,omitempty"`
+	// Timeout defaults to 15 minutes.
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// HTTPCheck passes when a GET request to the URL responds with a 2xx or 3xx
+// status. $(NODE_NAME) and $(NODE_IP) in the URL are replaced with the node's
+// name and internal address, which is enclosed in brackets if it is an IPv6
+// address.
+type HTTPCheck struct {
+	URL string `json:"url"`
+}
+
+// PodCheck passes when at least one pod matches the selector, and all of the
+// matching pods are ready.
+type PodCheck struct {
+	Namespace string               `json:"namespace"`
+	Selector  metav1.LabelSelector `json:"selector"`
+}
+
+// Verification defines how installer images are verified before upgrading.
+type Verification struct {
+	// Format is the signature format, one of Cosign (the default) or
+	// Notation.
+	// +kubebuilder:validation:Enum=Cosign;Notation
+	Format string `json:"format,omitempty"`
+	// PublicKeys are the PEM encoded public keys trusted to sign installer
+	// images. Versions without a valid signature from one of these keys are
+	// refused.
+	PublicKeys []string `json:"publicKeys"`
+}
+
+const (
+	// CosignFormat verifies cosign signatures.
+	CosignFormat = "Cosign"
+	// NotationFormat verifies notation signatures in JWS envelopes.
+	NotationFormat = "Notation"
+)
+
+const (
+	// RegistrySource resolves channels from the tags in the pool's registry
+	// and repository.
+	RegistrySource = "Registry"
+	// GitHubSource resolves channels from GitHub releases.
+	GitHubSource = "GitHub"
+	// ManifestSource resolves channels from a release manifest.
+	ManifestSource = "Manifest"
+)
+
+// VersionSource defines where channel versions are resolved from.
+type VersionSource struct {
+	// Type is one of Registry (the default), GitHub or Manifest.
+	// +kubebuilder:validation:Enum=Registry;GitHub;Manifest
+	Type string `json:"type,omitempty"`
+	// URL is the GitHub API URL or the release manifest's URL.
+	URL string `json:"url,omitempty"`
+	// Repository is the owner/name of the GitHub repository publishing
+	// releases.
+	Repository string `json:"repository,omitempty"`
+}
+
+// TagListing defines how the repository's tags are listed when discovering
+// channel versions.
+type TagListing struct {
+	// PageSize is the number of tags requested per page.
+	PageSize int `json:"pageSize,omitempty"`
+	// Limit is the maximum number of tags listed.
+	Limit int `json:"limit,omitempty"`
+	// Prefix restricts the listing to tags with the prefix (e.g. "v").
+	Prefix string `json:"prefix,omitempty"`
 }
 
 // PoolStatus defines the observed state of Pool
@@ -27,6 +285,91 @@ type PoolStatus struct {
 	NextRun    metav1.Time `json:"nextRun,omitempty"`
 	InProgress string      `json:"inProgress,omitempty"`
 	Version    string      `json:"version,omitempty"`
+	Image      string      `json:"image,omitempty"`
+	// Digest is the digest of the version's installer image, as published
+	// by the version source or verified. Upgrades are requested with the
+	// image pinned to it.
+	Digest  string       `json:"digest,omitempty"`
+	Message string       `json:"message,omitempty"`
+	Nodes   []NodeStatus `json:"nodes,omitempty"`
+}
+
+const (
+	// NodePending means that the node has been selected for upgrade, but the
+	// upgrade has not been requested yet.
+	NodePending = "Pending"
+	// NodePreUpgrade means that the node's pre-upgrade hook is running.
+	NodePreUpgrade = "PreUpgrade"
+	// NodeUpgrading means that the upgrade has been requested and the node is
+	// expected to reboot into the target version.
+	NodeUpgrading = "Upgrading"
+	// NodeVerifying means that the node is running the target version and is
+	// waiting to become healthy.
+	NodeVerifying = "Verifying"
+	// NodePostUpgrade means that the node is healthy, and its post-upgrade
+	// hook is running.
+	NodePostUpgrade = "PostUpgrade"
+	// NodeSucceeded means that the node is running the target version and is
+	// healthy.
+	NodeSucceeded = "Succeeded"
+	// NodeFailed means that the node failed to upgrade.
+	NodeFailed = "Failed"
+)
+
+const (
+	// NoAddressReason means that the node failed because it has no usable
+	// address to reach its Talos API on.
+	NoAddressReason = "NoAddress"
+	// RebootingReason means that the upgrading node is unreachable while it
+	// reboots into the target version.
+	RebootingReason = "Rebooting"
+	// UnsupportedOptionReason means that the node failed because it can not
+	// be upgraded with the pool's upgrade options.
+	UnsupportedOptionReason = "UnsupportedOption"
+)
+
+// NodeStatus is the upgrade state of a node in the pool. Upgrades advance
+// one phase at a time across reconciles, so that progress survives restarts.
+type NodeStatus struct {
+	Name string `json:"name"`
+	// Phase is one of Pending, PreUpgrade, Upgrading, Verifying,
+	// PostUpgrade, Succeeded or Failed.
+	Phase string `json:"phase,omitempty"`
+	// Version is the node's version when it was last observed.
+	Version string `json:"version,omitempty"`
+	// PreviousVersion is the version the node is being upgraded from.
+	PreviousVersion string `json:"previousVersion,omitempty"`
+	// TargetVersion is the version the node is being upgraded to.
+	TargetVersion      string       `json:"targetVersion,omitempty"`
+	LastTransitionTime metav1.Time  `json:"lastTransitionTime,omitempty"`
+	HealthySince       *metav1.Time `json:"healthySince,omitempty"`
+	// Reason is a CamelCase reason for the node's phase, if it is not
+	// explained by the phase alone.
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+	// Log references the captured log of the node's last upgrade attempt,
+	// e.g. configmap/talos-system/<name>.
+	Log string `json:"log,omitempty"`
+}
+
+// InProgress returns true if the node's upgrade has started and not yet
+// finished.
+func (s *NodeStatus) InProgress() bool {
+	switch s.Phase {
+	case NodePending, NodePreUpgrade, NodeUpgrading, NodeVerifying, NodePostUpgrade:
+		return true
+	default:
+		return false
+	}
+}
+
+// Transition moves the node to the phase.
+func (s *NodeStatus) Transition(phase, message string) {
+	s.Phase = phase
+	s.Reason = ""
+	s.Message = message
+	s.LastTransitionTime = metav1.NewTime(time.Now().UTC())
+	s.HealthySince = nil
 }
 
 // +kubebuilder:object:root=true
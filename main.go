@@ -12,7 +12,12 @@ import (
 	"time"
 
 	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
+	"github.com/talos-systems/talos-controller-manager/pkg/constants"
 	"github.com/talos-systems/talos-controller-manager/pkg/controllers"
+	"github.com/talos-systems/talos-controller-manager/pkg/metrics"
+	"github.com/talos-systems/talos-controller-manager/pkg/notifier"
+	"github.com/talos-systems/talos-controller-manager/pkg/status"
+	"github.com/talos-systems/talos-controller-manager/pkg/tracing"
 	"github.com/talos-systems/talos-controller-manager/pkg/upgrader"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -24,9 +29,11 @@ import (
 	"k8s.io/client-go/tools/leaderelection"
 	"k8s.io/client-go/tools/leaderelection/resourcelock"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -42,7 +49,7 @@ func init() {
 	// +kubebuilder:scaffold:scheme
 }
 
-func run(mgr manager.Manager, leaseName, namespace string) (err error) {
+func run(ctx context.Context, mgr manager.Manager, reconciler *controllers.PoolReconciler, flush func(context.Context) error, leaseName, namespace string) (err error) {
 	var config *rest.Config
 
 	kubeconfig, ok := os.LookupEnv("KUBECONFIG")
@@ -80,7 +87,18 @@ func run(mgr manager.Manager, leaseName, namespace string) (err error) {
 		},
 	}
 
-	leaderelection.RunOrDie(context.Background(), leaderelection.LeaderElectionConfig{
+	// The upgrades are cancelled, and no further reconciles are started,
+	// before the in-flight ones are waited on and the lease is released, so
+	// that the next leader does not race with them.
+	leaderCtx, leaderCancel := context.WithCancel(context.Background())
+
+	go func() {
+		<-ctx.Done()
+		reconciler.Shutdown()
+		leaderCancel()
+	}()
+
+	leaderelection.RunOrDie(leaderCtx, leaderelection.LeaderElectionConfig{
 		Lock: lock,
 		// IMPORTANT: you MUST ensure that any code you have that
 		// is protected by the lease must terminate **before**
@@ -95,13 +113,20 @@ func run(mgr manager.Manager, leaseName, namespace string) (err error) {
 		Callbacks: leaderelection.LeaderCallbacks{
 			OnStartedLeading: func(ctx context.Context) {
 				setupLog.Info("starting manager")
-				if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+				if err := mgr.Start(ctx.Done()); err != nil {
 					setupLog.Error(err, "problem running manager")
 					os.Exit(1)
 				}
 			},
 			OnStoppedLeading: func() {
 				log.Println("lost leadership")
+
+				flushCtx, flushCancel := context.WithTimeout(context.Background(), 5*time.Second)
+				if err := flush(flushCtx); err != nil {
+					log.Printf("failed to flush traces: %v", err)
+				}
+				flushCancel()
+
 				os.Exit(0)
 			},
 			OnNewLeader: func(identity string) {
@@ -117,8 +142,9 @@ func run(mgr manager.Manager, leaseName, namespace string) (err error) {
 }
 
 func main() {
-	var metricsAddr string
+	var metricsAddr, statusAddr string
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
+	flag.StringVar(&statusAddr, "status-addr", "127.0.0.1:8081", "The address the read-only pool status endpoint binds to, or 0 to disable it.")
 	flag.Parse()
 
 	ctrl.SetLogger(zap.Logger(true))
@@ -141,18 +167,78 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err = (&controllers.PoolReconciler{
-		Client:   mgr.GetClient(),
-		Log:      ctrl.Log.WithName("controllers").WithName("Pool"),
-		Upgrader: u,
-	}).SetupWithManager(mgr, controller.Options{MaxConcurrentReconciles: 10}); err != nil {
+	// The Talos API endpoints are refreshed while the controller is the
+	// leader.
+	if err = mgr.Add(u.TalosClient()); err != nil {
+		setupLog.Error(err, "unable to add Talos API client")
+		os.Exit(1)
+	}
+
+	if err = ctrlmetrics.Registry.Register(metrics.NewPoolCollector(mgr.GetClient())); err != nil {
+		setupLog.Error(err, "unable to register metrics")
+		os.Exit(1)
+	}
+
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to create clientset")
+		os.Exit(1)
+	}
+
+	flush, err := tracing.Setup(context.Background())
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		<-ctrl.SetupSignalHandler()
+		setupLog.Info("shutting down, aborting upgrades")
+		cancel()
+	}()
+
+	// The status is served whether or not we are the leader, so it is read
+	// directly from the API server rather than from the manager's cache,
+	// which is only started once we are elected.
+	if statusAddr != "0" {
+		statusClient, err := client.New(mgr.GetConfig(), client.Options{Scheme: scheme, Mapper: mgr.GetRESTMapper()})
+		if err != nil {
+			setupLog.Error(err, "unable to create status client")
+			os.Exit(1)
+		}
+
+		server := status.NewServer(statusClient, constants.DefaultNamespace, statusAddr)
+
+		go func() {
+			if err := server.Start(ctx.Done()); err != nil {
+				setupLog.Error(err, "problem running status server")
+				os.Exit(1)
+			}
+		}()
+	}
+
+	reconciler := &controllers.PoolReconciler{
+		Client:      mgr.GetClient(),
+		Log:         ctrl.Log.WithName("controllers").WithName("Pool"),
+		Upgrader:    u,
+		Namespace:   constants.DefaultNamespace,
+		Etcd:        u.EtcdCheck(),
+		LeaderMover: u.LeaderMover(),
+		Recorder:    mgr.GetEventRecorderFor("talos-controller-manager"),
+		Notifier:    notifier.NewNotifier(clientset, constants.DefaultNamespace),
+		Context:     ctx,
+	}
+
+	if err = reconciler.SetupWithManager(mgr, controller.Options{MaxConcurrentReconciles: 10}); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Pool")
 		os.Exit(1)
 	}
 	// +kubebuilder:scaffold:builder
 
 	setupLog.Info("starting manager")
-	if err := run(mgr, "talos-controller-manager", "talos-system"); err != nil {
+	if err := run(ctx, mgr, reconciler, flush, "talos-controller-manager", constants.DefaultNamespace); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
@@ -5,6 +5,7 @@
 package filter
 
 import (
+	"context"
 	"log"
 
 	"github.com/talos-systems/talos-controller-manager/pkg/channel"
@@ -15,14 +16,14 @@ import (
 	digest "github.com/opencontainers/go-digest"
 )
 
-func FilterTagsFor(s, reg, repository string) (target *string) {
-	repo, err := registry.New(reg, repository)
+func FilterTagsFor(ctx context.Context, s, reg, repository string) (target *string) {
+	repo, err := registry.New(ctx, reg, repository)
 	if err != nil {
 		log.Println(err)
 		return nil
 	}
 
-	manifest, err := repo.Manifest(s)
+	manifest, err := repo.Manifest(ctx, s)
 	if err != nil {
 		log.Println(err)
 		return nil
@@ -33,7 +34,7 @@ func FilterTagsFor(s, reg, repository string) (target *string) {
 		manifest.Digest.Encoded(),
 	)
 
-	config, err := repo.Configuration(dgst)
+	config, err := repo.Configuration(ctx, dgst)
 	if err != nil {
 		log.Println(err)
 		return nil
@@ -47,7 +48,26 @@ func FilterTagsFor(s, reg, repository string) (target *string) {
 
 // FilterSemver filters a set of tags by enforcing alpha >= beta >= stable.
 func FilterSemver(ch string, tags []string) (target *string) {
-	v1, _ := semver.New("0.0.0")
+	f := NewSemver(ch)
+	f.Add(tags)
+
+	return f.Target()
+}
+
+// Semver is a FilterSemver that consumes tags incrementally, so that tags can
+// be streamed from the registry a page at a time.
+type Semver struct {
+	channel string
+	v       semver.Version
+}
+
+func NewSemver(ch string) *Semver {
+	return &Semver{channel: ch}
+}
+
+// Add considers the tags as candidates for the channel.
+func (f *Semver) Add(tags []string) {
+	ch := f.channel
 
 	for _, tag := range tags {
 		v2, err := semver.ParseTolerant(tag)
@@ -92,18 +112,21 @@ func FilterSemver(ch string, tags []string) (target *string) {
 			// Nothing to do.
 		}
 
-		if v1.LT(v2) {
-			v1 = &v2
+		if f.v.LT(v2) {
+			f.v = v2
 		}
 	}
+}
 
+// Target returns the newest version seen so far, or nil if no tag matched.
+func (f *Semver) Target() (target *string) {
 	// Ensure that we don't return the target if no tag was found.
-	if v1.Major == 0 && v1.Minor == 0 && v1.Patch == 0 {
+	if f.v.Major == 0 && f.v.Minor == 0 && f.v.Patch == 0 {
 		return nil
 	}
 
 	// The "v" prefix is used in upstream tagging scheme.
-	s := "v" + v1.String()
+	s := "v" + f.v.String()
 	target = &s
 
 	return target
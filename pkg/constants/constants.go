@@ -10,10 +10,19 @@ const (
 	DefaultRepository = "autonomy/installer"
 
 	InstallerVersionLabel = "alpha.talos.dev/version"
+
+	DefaultNamespace = "talos-system"
 )
 
 // Pool labels
 
 const (
 	V1Alpha1PoolLabel = "v1alpha1.upgrade.talos.dev/pool"
+
+	// V1Alpha1HookLabel is set on hook Jobs to pre-upgrade or post-upgrade.
+	V1Alpha1HookLabel = "v1alpha1.upgrade.talos.dev/hook"
+
+	// V1Alpha1NodeAnnotation is set on upgrade logs and hook Jobs to the
+	// node's name.
+	V1Alpha1NodeAnnotation = "v1alpha1.upgrade.talos.dev/node"
 )
@@ -0,0 +1,118 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/blang/semver"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+
+	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
+	"github.com/talos-systems/talos-controller-manager/pkg/tracing"
+)
+
+// The reasons of the events recorded for the upgrade lifecycle.
+const (
+	VersionResolvedReason  = "VersionResolved"
+	UpgradeRequestedReason = "UpgradeRequested"
+	RebootingReason        = "Rebooting"
+	HealthyReason          = "Healthy"
+	UpgradeFailedReason    = "UpgradeFailed"
+	PausedReason           = "Paused"
+	RollbackStartedReason  = "RollbackStarted"
+)
+
+// step advances the node's upgrade by one step, and records the lifecycle
+// event, notification, metrics and trace of the step it took, if any.
+func (r *PoolReconciler) step(ctx context.Context, pool *poolv1alpha1.Pool, node *corev1.Node, s *poolv1alpha1.NodeStatus, log logr.Logger) {
+	phase, reason, since := s.Phase, s.Reason, s.LastTransitionTime
+
+	stepCtx, span := tracing.Start(ctx, "Step",
+		tracing.PoolKey.String(pool.Name),
+		tracing.NodeKey.String(node.Name),
+		tracing.PhaseKey.String(phase),
+		tracing.TargetVersionKey.String(s.TargetVersion),
+	)
+
+	err := r.Upgrader.Step(stepCtx, pool, *node, s)
+	if err != nil {
+		log.Error(err, "upgrade step failed", "node", node.Name, "phase", s.Phase)
+	}
+
+	tracing.End(span, err)
+
+	r.recordStep(pool, node, phase, reason, s)
+	r.notifyStep(pool, node, phase, s)
+	observeStep(pool, phase, since, s)
+	tracePhase(ctx, pool, node, phase, since, s)
+}
+
+// recordStep records an event on the pool and the node for the lifecycle step
+// from the phase and reason to the node's current ones.
+func (r *PoolReconciler) recordStep(pool *poolv1alpha1.Pool, node *corev1.Node, phase, reason string, s *poolv1alpha1.NodeStatus) {
+	if r.Recorder == nil || (s.Phase == phase && s.Reason == reason) {
+		return
+	}
+
+	switch {
+	case s.Phase == poolv1alpha1.NodeUpgrading && phase != poolv1alpha1.NodeUpgrading && isRollback(s.PreviousVersion, s.TargetVersion):
+		r.eventf(pool, node, corev1.EventTypeWarning, RollbackStartedReason, "Started rolling back %s from %s to %s", s.Name, s.PreviousVersion, s.TargetVersion)
+	case s.Phase == poolv1alpha1.NodeUpgrading && phase != poolv1alpha1.NodeUpgrading:
+		r.eventf(pool, node, corev1.EventTypeNormal, UpgradeRequestedReason, "Requested the upgrade of %s from %s to %s", s.Name, s.PreviousVersion, s.TargetVersion)
+	case s.Phase == poolv1alpha1.NodeUpgrading && s.Reason == poolv1alpha1.RebootingReason:
+		r.eventf(pool, node, corev1.EventTypeNormal, RebootingReason, "Node %s is rebooting from %s into %s", s.Name, s.PreviousVersion, s.TargetVersion)
+	case s.Phase == poolv1alpha1.NodeSucceeded && (phase == poolv1alpha1.NodeVerifying || phase == poolv1alpha1.NodePostUpgrade):
+		r.eventf(pool, node, corev1.EventTypeNormal, HealthyReason, "Node %s is healthy after upgrading from %s to %s", s.Name, s.PreviousVersion, s.TargetVersion)
+	case s.Phase == poolv1alpha1.NodeFailed:
+		r.eventf(pool, node, corev1.EventTypeWarning, UpgradeFailedReason, "Failed to upgrade %s from %s to %s: %s", s.Name, s.Version, s.TargetVersion, s.Message)
+
+		if pool.Spec.FailurePolicy == "Pause" {
+			r.Recorder.Eventf(pool, corev1.EventTypeWarning, PausedReason, "Upgrades to %s are paused after %s failed to upgrade", s.TargetVersion, s.Name)
+		}
+	}
+}
+
+// isRollback returns true if the target version is older than the node's
+// version, such as after a channel or pinned version is moved back.
+func isRollback(previous, target string) bool {
+	p, err := semver.ParseTolerant(previous)
+	if err != nil {
+		return false
+	}
+
+	t, err := semver.ParseTolerant(target)
+	if err != nil {
+		return false
+	}
+
+	return t.LT(p)
+}
+
+// recordVersion records an event on the pool for the version it is upgraded
+// to changing.
+func (r *PoolReconciler) recordVersion(pool *poolv1alpha1.Pool, v string) {
+	if r.Recorder == nil {
+		return
+	}
+
+	message := fmt.Sprintf("Resolved version %s for the %s channel", v, pool.Spec.Channel)
+	if pool.Spec.Version != "" {
+		message = fmt.Sprintf("Using the pinned version %s", v)
+	}
+
+	if pool.Status.Version != "" {
+		message += ", previously " + pool.Status.Version
+	}
+
+	r.Recorder.Event(pool, corev1.EventTypeNormal, VersionResolvedReason, message)
+}
+
+func (r *PoolReconciler) eventf(pool *poolv1alpha1.Pool, node *corev1.Node, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.Recorder.Eventf(pool, eventtype, reason, messageFmt, args...)
+	r.Recorder.Eventf(node, eventtype, reason, messageFmt, args...)
+}
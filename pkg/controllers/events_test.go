@@ -0,0 +1,103 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package controllers
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
+)
+
+func TestRecordStep(t *testing.T) {
+	tests := []struct {
+		name          string
+		failurePolicy string
+		phase         string
+		reason        string
+		status        poolv1alpha1.NodeStatus
+		want          []string
+	}{
+		{
+			name:   "requested",
+			phase:  poolv1alpha1.NodePending,
+			status: poolv1alpha1.NodeStatus{Phase: poolv1alpha1.NodeUpgrading},
+			want:   []string{UpgradeRequestedReason, UpgradeRequestedReason},
+		},
+		{
+			name:   "rollback",
+			phase:  poolv1alpha1.NodePending,
+			status: poolv1alpha1.NodeStatus{Phase: poolv1alpha1.NodeUpgrading, PreviousVersion: "v0.4.1", TargetVersion: "v0.4.0"},
+			want:   []string{RollbackStartedReason, RollbackStartedReason},
+		},
+		{
+			name:   "rebooting",
+			phase:  poolv1alpha1.NodeUpgrading,
+			status: poolv1alpha1.NodeStatus{Phase: poolv1alpha1.NodeUpgrading, Reason: poolv1alpha1.RebootingReason},
+			want:   []string{RebootingReason, RebootingReason},
+		},
+		{
+			name:   "still rebooting",
+			phase:  poolv1alpha1.NodeUpgrading,
+			reason: poolv1alpha1.RebootingReason,
+			status: poolv1alpha1.NodeStatus{Phase: poolv1alpha1.NodeUpgrading, Reason: poolv1alpha1.RebootingReason},
+		},
+		{
+			name:   "healthy",
+			phase:  poolv1alpha1.NodeVerifying,
+			status: poolv1alpha1.NodeStatus{Phase: poolv1alpha1.NodeSucceeded},
+			want:   []string{HealthyReason, HealthyReason},
+		},
+		{
+			name:   "up to date",
+			phase:  poolv1alpha1.NodePending,
+			status: poolv1alpha1.NodeStatus{Phase: poolv1alpha1.NodeSucceeded},
+		},
+		{
+			name:          "failed",
+			failurePolicy: "Pause",
+			phase:         poolv1alpha1.NodeVerifying,
+			status:        poolv1alpha1.NodeStatus{Phase: poolv1alpha1.NodeFailed},
+			want:          []string{UpgradeFailedReason, UpgradeFailedReason, PausedReason},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+
+			r := &PoolReconciler{Recorder: recorder}
+
+			pool := &poolv1alpha1.Pool{ObjectMeta: metav1.ObjectMeta{Name: "workers"}}
+			pool.Spec.FailurePolicy = tt.failurePolicy
+
+			node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-1"}}
+
+			r.recordStep(pool, node, tt.phase, tt.reason, &tt.status)
+
+			close(recorder.Events)
+
+			var got []string
+
+			for event := range recorder.Events {
+				var eventtype, reason string
+
+				if _, err := fmt.Sscanf(event, "%s %s", &eventtype, &reason); err != nil {
+					t.Fatal(err)
+				}
+
+				got = append(got, reason)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("recordStep() recorded %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package controllers
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
+	"github.com/talos-systems/talos-controller-manager/pkg/metrics"
+)
+
+// observeStep observes the time the node spent in the phase it left since
+// the transition into it, and counts the upgrades that finished.
+func observeStep(pool *poolv1alpha1.Pool, phase string, since metav1.Time, s *poolv1alpha1.NodeStatus) {
+	if s.Phase == phase {
+		return
+	}
+
+	if phase != "" && !since.IsZero() {
+		metrics.PhaseDuration.WithLabelValues(pool.Name, phase).Observe(time.Since(since.Time).Seconds())
+	}
+
+	switch {
+	case s.Phase == poolv1alpha1.NodeSucceeded && (phase == poolv1alpha1.NodeVerifying || phase == poolv1alpha1.NodePostUpgrade):
+		metrics.Upgrades.WithLabelValues(pool.Name, metrics.SucceededResult).Inc()
+	case s.Phase == poolv1alpha1.NodeFailed:
+		metrics.Upgrades.WithLabelValues(pool.Name, metrics.FailedResult).Inc()
+	}
+}
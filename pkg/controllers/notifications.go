@@ -0,0 +1,100 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package controllers
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+
+	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
+	"github.com/talos-systems/talos-controller-manager/pkg/notifier"
+)
+
+// notifyStep notifies the start of the rollout when the first node's upgrade
+// to the version is requested, and its pause when a node fails with
+// onFailure: Pause.
+func (r *PoolReconciler) notifyStep(pool *poolv1alpha1.Pool, node *corev1.Node, phase string, s *poolv1alpha1.NodeStatus) {
+	if r.Notifier == nil || s.Phase == phase {
+		return
+	}
+
+	switch {
+	case s.Phase == poolv1alpha1.NodeUpgrading && !rolloutStarted(pool, s):
+		e := notifier.NewEvent(pool, poolv1alpha1.RolloutStartedEvent, fmt.Sprintf("Started the rollout of %s to pool %s with the upgrade of %s from %s", s.TargetVersion, pool.Name, s.Name, s.PreviousVersion))
+		e.Version, e.PreviousVersion, e.Node = s.TargetVersion, s.PreviousVersion, node.Name
+
+		r.Notifier.Notify(pool, e)
+	case s.Phase == poolv1alpha1.NodeFailed && pool.Spec.FailurePolicy == "Pause":
+		e := notifier.NewEvent(pool, poolv1alpha1.RolloutPausedEvent, fmt.Sprintf("Paused the rollout of %s to pool %s after %s failed to upgrade: %s", s.TargetVersion, pool.Name, s.Name, s.Message))
+		e.Version, e.PreviousVersion, e.Node = s.TargetVersion, s.PreviousVersion, node.Name
+
+		r.Notifier.Notify(pool, e)
+	}
+}
+
+// notifyVersion notifies the version the pool is upgraded to changing.
+func (r *PoolReconciler) notifyVersion(pool *poolv1alpha1.Pool, v string) {
+	if r.Notifier == nil {
+		return
+	}
+
+	message := fmt.Sprintf("Pool %s resolved version %s for the %s channel", pool.Name, v, pool.Spec.Channel)
+	if pool.Spec.Version != "" {
+		message = fmt.Sprintf("Pool %s is pinned to version %s", pool.Name, v)
+	}
+
+	e := notifier.NewEvent(pool, poolv1alpha1.VersionResolvedEvent, message)
+	e.Version, e.PreviousVersion = v, pool.Status.Version
+
+	r.Notifier.Notify(pool, e)
+}
+
+// notifyFinished notifies the end of the rollout of the version.
+func (r *PoolReconciler) notifyFinished(pool *poolv1alpha1.Pool, v string, failed int) {
+	if r.Notifier == nil {
+		return
+	}
+
+	message := fmt.Sprintf("Finished the rollout of %s to pool %s", v, pool.Name)
+	if failed > 0 {
+		message += fmt.Sprintf(", %d of %d node(s) failed: %s", failed, pool.Status.Size, failures(pool, v))
+	}
+
+	e := notifier.NewEvent(pool, poolv1alpha1.RolloutFinishedEvent, message)
+	e.Version = v
+
+	r.Notifier.Notify(pool, e)
+}
+
+// rolloutStarted returns true if another node's upgrade to the node's target
+// version has already been requested.
+func rolloutStarted(pool *poolv1alpha1.Pool, s *poolv1alpha1.NodeStatus) bool {
+	for i := range pool.Status.Nodes {
+		other := &pool.Status.Nodes[i]
+
+		if other.Name == s.Name || other.TargetVersion != s.TargetVersion || other.PreviousVersion == "" {
+			continue
+		}
+
+		switch other.Phase {
+		case poolv1alpha1.NodeUpgrading, poolv1alpha1.NodeVerifying, poolv1alpha1.NodePostUpgrade, poolv1alpha1.NodeSucceeded, poolv1alpha1.NodeFailed:
+			return true
+		}
+	}
+
+	return false
+}
+
+// isUpgrading returns true if the node's upgrade has been requested and has
+// not finished.
+func isUpgrading(s *poolv1alpha1.NodeStatus) bool {
+	switch s.Phase {
+	case poolv1alpha1.NodeUpgrading, poolv1alpha1.NodeVerifying, poolv1alpha1.NodePostUpgrade:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,59 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package controllers
+
+import (
+	"testing"
+
+	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
+)
+
+func TestRolloutStarted(t *testing.T) {
+	tests := []struct {
+		name  string
+		other poolv1alpha1.NodeStatus
+		want  bool
+	}{
+		{
+			name:  "first upgrade",
+			other: poolv1alpha1.NodeStatus{Name: "worker-2", Phase: poolv1alpha1.NodePending, TargetVersion: "v0.4.0"},
+		},
+		{
+			name:  "up to date",
+			other: poolv1alpha1.NodeStatus{Name: "worker-2", Phase: poolv1alpha1.NodeSucceeded, TargetVersion: "v0.4.0"},
+		},
+		{
+			name:  "previous rollout",
+			other: poolv1alpha1.NodeStatus{Name: "worker-2", Phase: poolv1alpha1.NodeSucceeded, PreviousVersion: "v0.3.1", TargetVersion: "v0.3.2"},
+		},
+		{
+			name:  "waiting on hook",
+			other: poolv1alpha1.NodeStatus{Name: "worker-2", Phase: poolv1alpha1.NodePreUpgrade, PreviousVersion: "v0.3.2", TargetVersion: "v0.4.0"},
+		},
+		{
+			name:  "upgraded",
+			other: poolv1alpha1.NodeStatus{Name: "worker-2", Phase: poolv1alpha1.NodeSucceeded, PreviousVersion: "v0.3.2", TargetVersion: "v0.4.0"},
+			want:  true,
+		},
+		{
+			name:  "upgrading",
+			other: poolv1alpha1.NodeStatus{Name: "worker-2", Phase: poolv1alpha1.NodeVerifying, PreviousVersion: "v0.3.2", TargetVersion: "v0.4.0"},
+			want:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := &poolv1alpha1.Pool{}
+			pool.Status.Nodes = []poolv1alpha1.NodeStatus{
+				{Name: "worker-1", Phase: poolv1alpha1.NodeUpgrading, PreviousVersion: "v0.3.2", TargetVersion: "v0.4.0"},
+				tt.other,
+			}
+
+			if got := rolloutStarted(pool, &pool.Status.Nodes[0]); got != tt.want {
+				t.Errorf("rolloutStarted() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
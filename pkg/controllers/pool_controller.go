@@ -7,48 +7,194 @@ package controllers
 import (
 	"context"
 	"fmt"
-	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
+	lru "github.com/hashicorp/golang-lru"
+	digest "github.com/opencontainers/go-digest"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 
 	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
-	"github.com/talos-systems/talos-controller-manager/pkg/channel"
 	"github.com/talos-systems/talos-controller-manager/pkg/constants"
+	"github.com/talos-systems/talos-controller-manager/pkg/notifier"
+	"github.com/talos-systems/talos-controller-manager/pkg/registry"
+	"github.com/talos-systems/talos-controller-manager/pkg/signature"
+	"github.com/talos-systems/talos-controller-manager/pkg/tracing"
 	"github.com/talos-systems/talos-controller-manager/pkg/upgrader"
 	"github.com/talos-systems/talos-controller-manager/pkg/version"
 )
 
+const (
+	// stepInterval is how often upgrades in progress are advanced.
+	stepInterval = 10 * time.Second
+
+	// verificationCacheSize is the number of image verification results
+	// cached.
+	verificationCacheSize = 256
+)
+
 // PoolReconciler reconciles a Pool object
 type PoolReconciler struct {
 	client.Client
-	Log      logr.Logger
-	Upgrader upgrader.Upgrader
+	Log       logr.Logger
+	Upgrader  upgrader.Upgrader
+	Namespace string
+
+	// Etcd checks the health of every etcd member before a control plane
+	// node is upgraded. Control plane nodes are not protected if it is nil.
+	Etcd upgrader.HealthCheck
+	// LeaderMover moves etcd leadership off a control plane node before it
+	// is upgraded, in pools with the forfeitEtcdLeadership upgrade option.
+	LeaderMover upgrader.LeaderMover
+
+	// Recorder records the upgrade lifecycle events on the pool and its
+	// nodes. No events are recorded if it is nil.
+	Recorder record.EventRecorder
+
+	Notifier *notifier.Notifier
+
+	// Context is the parent of all reconciles. Cancelling it (e.g. on
+	// shutdown) aborts in-flight upgrades.
+	Context context.Context
+
+	resolvers     *Resolvers
+	verifications *lru.Cache
+
+	// Each pool's work runs with a context derived from Context, which is
+	// cancelled once the pool is deleted. No reconciles are started once
+	// stopping is set, so that Shutdown can wait on the in-flight ones.
+	mu       sync.Mutex
+	stopping bool
+	pools    map[string]poolContext
+	wg       sync.WaitGroup
+}
+
+// poolContext is the context of a pool's work.
+type poolContext struct {
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 // +kubebuilder:rbac:groups=upgrade.talos.dev,resources=pools,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=upgrade.talos.dev,resources=pools/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=endpoints,verbs=get
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;create;delete
+// +kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get
 
 func (r *PoolReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
-	ctx := context.Background()
 	log := r.Log.WithValues("pool", req.Name)
 
-	return r.reconcile(ctx, req, log)
+	ctx, ok := r.begin(req.Name)
+	if !ok {
+		log.Info("shutting down, skipping reconciliation")
+
+		return ctrl.Result{}, nil
+	}
+
+	defer r.wg.Done()
+
+	ctx, span := tracing.Start(ctx, "Reconcile", tracing.PoolKey.String(req.Name))
+
+	result, err := r.reconcile(ctx, req, log)
+
+	tracing.End(span, err)
+
+	return result, err
+}
+
+// begin returns the context of the pool's reconcile, and false once the
+// reconciler is shutting down.
+func (r *PoolReconciler) begin(name string) (context.Context, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stopping {
+		return nil, false
+	}
+
+	r.wg.Add(1)
+
+	if r.pools == nil {
+		r.pools = map[string]poolContext{}
+	}
+
+	p, ok := r.pools[name]
+	if !ok {
+		parent := r.Context
+		if parent == nil {
+			parent = context.Background()
+		}
+
+		p.ctx, p.cancel = context.WithCancel(parent)
+		r.pools[name] = p
+	}
+
+	return p.ctx, true
+}
+
+// forget aborts the work of a deleted pool.
+func (r *PoolReconciler) forget(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if p, ok := r.pools[name]; ok {
+		p.cancel()
+
+		delete(r.pools, name)
+	}
+
+	if r.resolvers != nil {
+		r.resolvers.remove(name)
+	}
+}
+
+// Shutdown stops starting reconciles, and blocks until the in-flight ones
+// have returned and the notifier's workers have stopped.
+func (r *PoolReconciler) Shutdown() {
+	r.mu.Lock()
+	r.stopping = true
+	r.mu.Unlock()
+
+	r.wg.Wait()
+
+	if r.Notifier != nil {
+		r.Notifier.Shutdown()
+	}
 }
 
 func (r *PoolReconciler) SetupWithManager(mgr ctrl.Manager, options controller.Options) error {
+	// The versions of the pools are resolved in the background while the
+	// manager runs.
+	r.resolvers = NewResolvers(r.Client, r.Namespace)
+
+	if err := mgr.Add(r.resolvers); err != nil {
+		return err
+	}
+
+	verifications, err := lru.New(verificationCacheSize)
+	if err != nil {
+		return err
+	}
+
+	r.verifications = verifications
+
 	return ctrl.NewControllerManagedBy(mgr).
 		WithOptions(options).
 		For(&poolv1alpha1.Pool{}).
@@ -60,6 +206,8 @@ func (r *PoolReconciler) reconcile(ctx context.Context, req ctrl.Request, log lo
 
 	if err := r.Get(ctx, req.NamespacedName, &pool); err != nil {
 		if apierrors.IsNotFound(err) {
+			r.forget(req.Name)
+
 			return ctrl.Result{}, nil
 		}
 
@@ -72,42 +220,113 @@ func (r *PoolReconciler) reconcile(ctx context.Context, req ctrl.Request, log lo
 
 	v := pool.Spec.Version
 
+	var image, dgst string
+
 	if v == "" {
-		// TODO(andrewrynhard): Should these be configurable?
-		channels := []channel.Channel{
-			channel.LatestChannel,
-			channel.EdgeChannel,
-			channel.AlphaChannel,
-			channel.BetaChannel,
-			channel.StableChannel,
+		res, err := r.resolvers.get(ctx, &pool, log)
+		if err != nil {
+			return r.Result(ctx, req, false, log), err
 		}
 
-		cache := version.NewVersion(&version.V1Alpha1{})
-
-		go func() {
-			if err := cache.Run(pool.Spec.Registry, pool.Spec.Repository, channels); err != nil {
-				log.Error(err, "version cache failed")
-				os.Exit(1)
+		if _, ok := res.cache.Get(pool.Spec.Channel); !ok {
+			if !res.cache.WaitForCacheSync(ctx) {
+				return r.Result(ctx, req, false, log), fmt.Errorf("timeout waiting for version cache to sync")
 			}
-		}()
-
-		if !cache.WaitForCacheSync() {
-			return r.Result(ctx, req, false, log), fmt.Errorf("timeout waiting for version cache to sync")
 		}
 
 		var ok bool
 
-		if v, ok = cache.Get(pool.Spec.Channel); !ok {
+		if v, ok = res.cache.Get(pool.Spec.Channel); !ok {
+			if err := res.cache.Err(); err != nil {
+				return r.Result(ctx, req, false, log), fmt.Errorf("failed to resolve the %q channel: %w", pool.Spec.Channel, err)
+			}
+
 			return r.Result(ctx, req, false, log), fmt.Errorf("no version found for %q channel", pool.Spec.Channel)
 		}
 
+		// The upgrades are pinned to the digest published by the source.
+		if entry, ok := res.persisted.Entry(pool.Spec.Channel); ok && entry.Version == v {
+			image = entry.Image
+			dgst = entry.Digest
+		}
+
 		log.Info("obtained version for pool", "version", v, "channel", pool.Spec.Channel)
 	}
 
-	if pool.Status.Version != v {
+	if pool.Status.Version != v || pool.Status.Image != image || (dgst != "" && pool.Status.Digest != dgst) {
+		if pool.Status.Version != v {
+			r.recordVersion(&pool, v)
+			r.notifyVersion(&pool, v)
+		}
+
 		pool.Status.Version = v
+		pool.Status.Image = image
+		pool.Status.Digest = dgst
 
-		if err := r.Update(context.TODO(), &pool); err != nil {
+		if err := r.Update(ctx, &pool); err != nil {
+			return r.Result(ctx, req, false, log), err
+		}
+	}
+
+	// Refuse to start upgrades to images that are not signed by a trusted
+	// key. The upgrades that were already requested are still stepped.
+
+	var verifyErr error
+
+	if pool.Spec.Verification != nil {
+		dgst, err := r.verify(ctx, &pool, v)
+		if err != nil {
+			log.Error(err, "installer image verification failed", "version", v)
+
+			verifyErr = err
+		} else if pool.Status.Digest != dgst.String() {
+			pool.Status.Digest = dgst.String()
+
+			if err := r.Update(ctx, &pool); err != nil {
+				return r.Result(ctx, req, false, log), err
+			}
+		}
+	}
+
+	// Refuse to upgrade with invalid timeouts.
+
+	timeouts, err := upgrader.NewTimeouts(pool.Spec.Timeouts)
+	if err != nil {
+		log.Error(err, "invalid timeouts")
+
+		pool.Status.Message = fmt.Sprintf("invalid timeouts: %v", err)
+
+		if err := r.Update(ctx, &pool); err != nil {
+			log.Error(err, "failed to update pool")
+		}
+
+		return r.Result(ctx, req, true, log), err
+	}
+
+	// Refuse to upgrade with notifications that can not be rendered.
+
+	if err := notifier.Validate(pool.Spec.Notifications); err != nil {
+		log.Error(err, "invalid notifications")
+
+		pool.Status.Message = fmt.Sprintf("invalid notifications: %v", err)
+
+		if err := r.Update(ctx, &pool); err != nil {
+			log.Error(err, "failed to update pool")
+		}
+
+		return r.Result(ctx, req, true, log), err
+	}
+
+	var message string
+
+	if verifyErr != nil {
+		message = fmt.Sprintf("refusing to upgrade to %s: %v", v, verifyErr)
+	}
+
+	if pool.Status.Message != message {
+		pool.Status.Message = message
+
+		if err := r.Update(ctx, &pool); err != nil {
 			return r.Result(ctx, req, false, log), err
 		}
 	}
@@ -129,61 +348,215 @@ func (r *PoolReconciler) reconcile(ctx context.Context, req ctrl.Request, log lo
 		return r.Result(ctx, req, false, log), err
 	}
 
-	// Update the size status.
+	// Update the size status, and track the upgrade state of every node in
+	// the pool.
 
 	pool.Status.Size = len(nodes.Items)
 
-	if err := r.Update(context.TODO(), &pool); err != nil {
+	statuses := nodeStatuses(&pool, nodes)
+
+	if err := r.Update(ctx, &pool); err != nil {
 		return r.Result(ctx, req, false, log), err
 	}
 
-	// Check if we should run an upgrade.
+	// No further nodes are started once the failure budget is spent.
 
-	if time.Until(pool.Status.NextRun.Time) > pool.Spec.CheckInterval.Duration {
-		log.Info("rescheduling next run to checkInterval duration", "checkinterval", pool.Spec.CheckInterval.Duration)
+	budget, err := failureBudget(pool.Spec.MaxFailures, len(nodes.Items))
+	if err != nil {
+		log.Error(err, "invalid failure budget")
 
-		pool.Status.NextRun = metav1.NewTime(time.Now().UTC().Add(pool.Spec.CheckInterval.Duration))
+		pool.Status.Message = err.Error()
 
-		if err := r.Update(context.TODO(), &pool); err != nil {
-			return r.Result(ctx, req, false, log), err
+		if err := r.Update(ctx, &pool); err != nil {
+			log.Error(err, "failed to update pool")
 		}
 
-		return ctrl.Result{RequeueAfter: pool.Spec.CheckInterval.Duration}, nil
+		return r.Result(ctx, req, true, log), err
 	}
 
-	if pool.Status.NextRun.Time.After(time.Now().UTC()) {
-		log.Info("skipping reconciliation, next run is in the future")
-		return ctrl.Result{RequeueAfter: pool.Spec.CheckInterval.Duration}, nil
+	spent := func() bool {
+		return budget > 0 && count(statuses, isFailed(v)) >= budget
 	}
 
-	// Attempt to continue any existing upgrades.
+	// Refuse to upgrade with an invalid strategy.
+
+	policy, err := upgrader.NewPolicy(upgrader.PolicyOptions{
+		Pool:     &pool,
+		Nodes:    nodes.Items,
+		Statuses: statuses,
+	})
+	if err != nil {
+		log.Error(err, "invalid strategy")
 
-	poolStatusInProgress := strings.Split(pool.Status.InProgress, ",")
+		pool.Status.Message = fmt.Sprintf("invalid strategy: %v", err)
 
-	nodesInProgess := corev1.NodeList{}
-	for _, node := range nodes.Items {
-		for _, n := range poolStatusInProgress {
-			if node.Name == n {
-				nodesInProgess.Items = append(nodesInProgess.Items, node)
+		if err := r.Update(ctx, &pool); err != nil {
+			log.Error(err, "failed to update pool")
+		}
+
+		return r.Result(ctx, req, true, log), err
+	}
+
+	// Control plane nodes are always protected, whatever the strategy.
+	if r.Etcd != nil {
+		quorum := upgrader.EtcdQuorumPolicy{
+			Fallback: policy,
+			Etcd:     r.Etcd,
+			Timeout:  timeouts.Request,
+		}
+
+		if pool.Spec.Upgrade != nil && pool.Spec.Upgrade.ForfeitEtcdLeadership {
+			quorum.LeaderMover = r.LeaderMover
+		}
+
+		policy = quorum
+	}
+
+	// Check if we should start a new run. A run that is in progress, or that
+	// has nodes left to check for the same version, is always continued.
+
+	unfinished := count(statuses, isUnchecked) > 0 && count(statuses, isStale(v)) == 0 && !spent()
+
+	if count(statuses, isInProgress) == 0 && pool.Spec.FailurePolicy == "Pause" && count(statuses, isFailed(v)) > 0 {
+		log.Info("upgrades are paused until the version changes", "version", v)
+
+		return ctrl.Result{}, nil
+	}
+
+	if count(statuses, isInProgress) == 0 && verifyErr != nil {
+		return r.Result(ctx, req, true, log), verifyErr
+	}
+
+	if count(statuses, isInProgress) == 0 && !unfinished {
+		if time.Until(pool.Status.NextRun.Time) > pool.Spec.CheckInterval.Duration {
+			log.Info("rescheduling next run to checkInterval duration", "checkinterval", pool.Spec.CheckInterval.Duration)
+
+			pool.Status.NextRun = metav1.NewTime(time.Now().UTC().Add(pool.Spec.CheckInterval.Duration))
+
+			if err := r.Update(ctx, &pool); err != nil {
+				return r.Result(ctx, req, false, log), err
 			}
+
+			return ctrl.Result{RequeueAfter: pool.Spec.CheckInterval.Duration}, nil
+		}
+
+		if pool.Status.NextRun.Time.After(time.Now().UTC()) {
+			log.Info("skipping reconciliation, next run is in the future")
+			return ctrl.Result{RequeueAfter: pool.Spec.CheckInterval.Duration}, nil
 		}
+
+		// Every node is checked once per run.
+		for _, s := range statuses {
+			s.Phase = ""
+			s.Message = ""
+		}
+	}
+
+	// Advance the upgrades in progress by one step. The rollout is finished
+	// once the last of the requested upgrades finishes.
+	upgrading := count(statuses, isUpgrading)
+
+	log.Info("upgrades in progress", "count", count(statuses, isInProgress), "channel", pool.Spec.Channel)
+
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		s := statuses[node.Name]
+
+		if !s.InProgress() {
+			continue
+		}
+
+		// The upgrade of an unverified image is not requested.
+		if verifyErr != nil && !isUpgrading(s) {
+			continue
+		}
+
+		r.step(ctx, &pool, node, s, log)
 	}
 
-	log.Info("upgrades in progress", "count", len(nodesInProgess.Items), "channel", pool.Spec.Channel)
+	// Start upgrading the nodes that have not been checked in this run.
+
+	var wait time.Duration
+
+	started := map[string]bool{}
+
+	for verifyErr == nil && !spent() && !(pool.Spec.FailurePolicy == "Pause" && count(statuses, isFailed(v)) > 0) {
+		var candidates []corev1.Node
+
+		for _, node := range nodes.Items {
+			if s := statuses[node.Name]; s.Phase == "" && !started[node.Name] {
+				candidates = append(candidates, node)
+			}
+		}
+
+		selected, err := policy.Select(ctx, candidates, count(statuses, isInProgress))
+		if w, ok := err.(upgrader.WaitError); ok {
+			log.Info("upgrade policy is waiting", "after", w.After())
+
+			wait = w.After()
+
+			break
+		}
+
+		if err != nil {
+			log.Error(err, "upgrade policy refused to select nodes")
+
+			pool.Status.Message = err.Error()
+
+			break
+		}
+
+		if len(selected) == 0 {
+			break
+		}
+
+		for i := range selected {
+			node := &selected[i]
+			s := statuses[node.Name]
+			s.TargetVersion = v
+			s.Transition(poolv1alpha1.NodePending, "")
 
-	policy := upgrader.NewConcurrentPolicy(r.Upgrader, pool.Spec.Concurrency)
+			started[node.Name] = true
 
-	if len(nodesInProgess.Items) > 0 {
-		if err := policy.Run(req, nodesInProgess, v, true); err != nil {
-			log.Error(err, "upgrade failed")
+			r.step(ctx, &pool, node, s, log)
+		}
+	}
 
-			return r.Result(ctx, req, true, log), err
+	var names []string
+
+	for _, s := range pool.Status.Nodes {
+		if s.InProgress() {
+			names = append(names, s.Name)
 		}
 	}
 
-	// Upgrade all nodes.
+	pool.Status.InProgress = strings.Join(names, ",")
+
+	if spent() {
+		pool.Status.Message = fmt.Sprintf("no further nodes are started after %d failure(s): %s", count(statuses, isFailed(v)), failures(&pool, v))
+	}
+
+	if err := r.Update(ctx, &pool); err != nil {
+		return r.Result(ctx, req, false, log), err
+	}
+
+	if upgrading > 0 && len(names) == 0 && wait == 0 && (count(statuses, isUnchecked) == 0 || spent()) {
+		r.notifyFinished(&pool, v, count(statuses, isFailed(v)))
+	}
+
+	// Requeue until the run is complete.
+
+	if len(names) > 0 {
+		return ctrl.Result{RequeueAfter: stepInterval}, nil
+	}
+
+	if wait > 0 {
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
+
+	if failed := count(statuses, isFailed(v)); failed > 0 {
+		err := fmt.Errorf("%d node(s) failed to upgrade to %s: %s", failed, v, failures(&pool, v))
 
-	if err := policy.Run(req, nodes, v, false); err != nil {
 		log.Error(err, "upgrade failed")
 
 		return r.Result(ctx, req, true, log), err
@@ -192,6 +565,206 @@ func (r *PoolReconciler) reconcile(ctx context.Context, req ctrl.Request, log lo
 	return r.Result(ctx, req, false, log), nil
 }
 
+// nodeStatuses returns the status of each node in the pool, keyed by name.
+// Statuses of nodes that left the pool are dropped.
+func nodeStatuses(pool *poolv1alpha1.Pool, nodes corev1.NodeList) map[string]*poolv1alpha1.NodeStatus {
+	existing := map[string]poolv1alpha1.NodeStatus{}
+
+	for _, s := range pool.Status.Nodes {
+		existing[s.Name] = s
+	}
+
+	// Upgrades started before node statuses were recorded are resumed.
+	for _, name := range strings.Split(pool.Status.InProgress, ",") {
+		if _, ok := existing[name]; !ok && name != "" {
+			existing[name] = poolv1alpha1.NodeStatus{
+				Name:               name,
+				Phase:              poolv1alpha1.NodeUpgrading,
+				TargetVersion:      pool.Status.Version,
+				LastTransitionTime: metav1.NewTime(time.Now().UTC()),
+			}
+		}
+	}
+
+	pool.Status.Nodes = make([]poolv1alpha1.NodeStatus, 0, len(nodes.Items))
+
+	for _, node := range nodes.Items {
+		s, ok := existing[node.Name]
+		if !ok {
+			s = poolv1alpha1.NodeStatus{Name: node.Name}
+		}
+
+		pool.Status.Nodes = append(pool.Status.Nodes, s)
+	}
+
+	statuses := map[string]*poolv1alpha1.NodeStatus{}
+
+	for i := range pool.Status.Nodes {
+		statuses[pool.Status.Nodes[i].Name] = &pool.Status.Nodes[i]
+	}
+
+	return statuses
+}
+
+func count(statuses map[string]*poolv1alpha1.NodeStatus, f func(*poolv1alpha1.NodeStatus) bool) (n int) {
+	for _, s := range statuses {
+		if f(s) {
+			n++
+		}
+	}
+
+	return n
+}
+
+func isInProgress(s *poolv1alpha1.NodeStatus) bool {
+	return s.InProgress()
+}
+
+func isUnchecked(s *poolv1alpha1.NodeStatus) bool {
+	return s.Phase == ""
+}
+
+// isStale returns true if the node was checked for a different version.
+func isStale(v string) func(*poolv1alpha1.NodeStatus) bool {
+	return func(s *poolv1alpha1.NodeStatus) bool {
+		return s.Phase != "" && s.TargetVersion != v
+	}
+}
+
+func isFailed(v string) func(*poolv1alpha1.NodeStatus) bool {
+	return func(s *poolv1alpha1.NodeStatus) bool {
+		return s.Phase == poolv1alpha1.NodeFailed && s.TargetVersion == v
+	}
+}
+
+// failures lists the nodes that failed to upgrade to the version, and why.
+func failures(pool *poolv1alpha1.Pool, v string) string {
+	var failed []string
+
+	for i := range pool.Status.Nodes {
+		if s := &pool.Status.Nodes[i]; isFailed(v)(s) {
+			failed = append(failed, fmt.Sprintf("%s: %s", s.Name, s.Message))
+		}
+	}
+
+	return strings.Join(failed, "; ")
+}
+
+// failureBudget returns the number of failed upgrades that stop a run, or
+// zero if failures never stop it.
+func failureBudget(maxFailures *intstr.IntOrString, size int) (int, error) {
+	if maxFailures == nil {
+		return 0, nil
+	}
+
+	n, err := intstr.GetValueFromIntOrPercent(maxFailures, size, true)
+	if err != nil {
+		return 0, fmt.Errorf("invalid maxFailures: %w", err)
+	}
+
+	if n < 1 && size > 0 {
+		return 0, fmt.Errorf("maxFailures must allow at least one failure, got %s", maxFailures.String())
+	}
+
+	return n, nil
+}
+
+// verify returns the digest of the version's installer image once its
+// signature is verified. The results are cached by the signature format, the
+// trusted keys and the image's digest, so that each digest is only verified once.
+func (r *PoolReconciler) verify(ctx context.Context, pool *poolv1alpha1.Pool, v string) (digest.Digest, error) {
+	image, err := upgrader.InstallerImage(pool, v)
+	if err != nil {
+		return "", err
+	}
+
+	dgst, err := registry.ImageDigest(ctx, image)
+	if err != nil {
+		return "", err
+	}
+
+	pinned, err := registry.PinImage(image, dgst)
+	if err != nil {
+		return "", err
+	}
+
+	key := strings.Join(append([]string{pinned, pool.Spec.Verification.Format}, pool.Spec.Verification.PublicKeys...), "\n")
+
+	if result, ok := r.verifications.Get(key); ok {
+		return dgst, result.(verification).err
+	}
+
+	verifier, err := verifier(pool.Spec.Verification)
+	if err != nil {
+		return "", err
+	}
+
+	err = verifier.Verify(ctx, pinned)
+
+	// Errors reaching the registry are not cached, so that they are retried.
+	switch err.(type) {
+	case nil, signature.UnsignedError, signature.UntrustedError:
+		r.verifications.Add(key, verification{err: err})
+	}
+
+	return dgst, err
+}
+
+// verification is the cached result of verifying an image.
+type verification struct {
+	err error
+}
+
+func verifier(verification *poolv1alpha1.Verification) (signature.Verifier, error) {
+	switch verification.Format {
+	case "", poolv1alpha1.CosignFormat:
+		return signature.NewCosign(verification.PublicKeys)
+	case poolv1alpha1.NotationFormat:
+		return signature.NewNotation(verification.PublicKeys)
+	default:
+		return nil, fmt.Errorf("unknown signature format %q", verification.Format)
+	}
+}
+
+func versionSource(pool *poolv1alpha1.Pool) (version.VersionSource, error) {
+	source := pool.Spec.Source
+	if source == nil {
+		source = &poolv1alpha1.VersionSource{}
+	}
+
+	switch source.Type {
+	case "", poolv1alpha1.RegistrySource:
+		return &version.RegistrySource{
+			Registry:   pool.Spec.Registry,
+			Repository: pool.Spec.Repository,
+			Options:    tagsOptions(pool.Spec.Tags),
+		}, nil
+	case poolv1alpha1.GitHubSource:
+		return &version.GitHubSource{
+			URL:        source.URL,
+			Repository: source.Repository,
+		}, nil
+	case poolv1alpha1.ManifestSource:
+		return &version.ManifestSource{
+			URL: source.URL,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown version source %q", source.Type)
+	}
+}
+
+func tagsOptions(listing *poolv1alpha1.TagListing) []registry.TagsOption {
+	if listing == nil {
+		return nil
+	}
+
+	return []registry.TagsOption{
+		registry.WithPageSize(listing.PageSize),
+		registry.WithLimit(listing.Limit),
+		registry.WithPrefix(listing.Prefix),
+	}
+}
+
 func (r *PoolReconciler) Result(ctx context.Context, req ctrl.Request, fail bool, log logr.Logger) ctrl.Result {
 	var pool poolv1alpha1.Pool
 
@@ -0,0 +1,88 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestFailureBudget(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxFailures *intstr.IntOrString
+		size        int
+		want        int
+		wantErr     bool
+	}{
+		{name: "unset", size: 10, want: 0},
+		{name: "absolute", maxFailures: intstrPtr(intstr.FromInt(2)), size: 10, want: 2},
+		{name: "percentage", maxFailures: intstrPtr(intstr.FromString("25%")), size: 10, want: 3},
+		{name: "small percentage", maxFailures: intstrPtr(intstr.FromString("1%")), size: 10, want: 1},
+		{name: "zero", maxFailures: intstrPtr(intstr.FromInt(0)), size: 10, wantErr: true},
+		{name: "invalid", maxFailures: intstrPtr(intstr.FromString("two")), size: 10, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := failureBudget(tt.maxFailures, tt.size)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("failureBudget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("failureBudget() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func intstrPtr(i intstr.IntOrString) *intstr.IntOrString {
+	return &i
+}
+
+func TestShutdown(t *testing.T) {
+	r := &PoolReconciler{}
+
+	ctx, ok := r.begin("workers")
+	if !ok {
+		t.Fatal("begin() refused a reconcile before shutdown")
+	}
+
+	// Deleting the pool aborts its work.
+	r.forget("workers")
+
+	select {
+	case <-ctx.Done():
+	default:
+		t.Error("forget() did not cancel the pool's context")
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		r.Shutdown()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("Shutdown() returned before the in-flight reconcile")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if _, ok := r.begin("workers"); ok {
+		t.Error("begin() started a reconcile after shutdown")
+	}
+
+	r.wg.Done()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Shutdown() did not return once the reconcile finished")
+	}
+}
@@ -0,0 +1,162 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
+	"github.com/talos-systems/talos-controller-manager/pkg/channel"
+	"github.com/talos-systems/talos-controller-manager/pkg/version"
+)
+
+// TODO(andrewrynhard): Should these be configurable?
+var channels = []channel.Channel{
+	channel.LatestChannel,
+	channel.EdgeChannel,
+	channel.AlphaChannel,
+	channel.BetaChannel,
+	channel.StableChannel,
+}
+
+// Resolvers runs one version resolver per pool in the background. It is a
+// manager.Runnable, so that the resolvers stop with the manager.
+type Resolvers struct {
+	client    client.Client
+	namespace string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	resolvers map[string]*resolver
+}
+
+// resolver resolves the versions of a pool's channels from its source.
+type resolver struct {
+	// key identifies the source, so that the resolver is restarted when
+	// the pool's source changes.
+	key       string
+	persisted *version.ConfigMap
+	cache     *version.Version
+	cancel    context.CancelFunc
+}
+
+// NewResolvers returns resolvers that persist the versions in ConfigMaps in
+// the namespace.
+func NewResolvers(c client.Client, namespace string) *Resolvers {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Resolvers{
+		client:    c,
+		namespace: namespace,
+		ctx:       ctx,
+		cancel:    cancel,
+		resolvers: map[string]*resolver{},
+	}
+}
+
+// Start implements the manager.Runnable interface. It stops every resolver
+// once the stop channel is closed.
+func (r *Resolvers) Start(stop <-chan struct{}) error {
+	<-stop
+
+	r.cancel()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.resolvers = map[string]*resolver{}
+
+	return nil
+}
+
+// get returns the pool's resolver, starting one if the pool has none or its
+// source changed.
+func (r *Resolvers) get(ctx context.Context, pool *poolv1alpha1.Pool, log logr.Logger) (*resolver, error) {
+	source, err := versionSource(pool)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := sourceKey(pool)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if res, ok := r.resolvers[pool.Name]; ok {
+		if res.key == key {
+			return res, nil
+		}
+
+		res.cancel()
+	}
+
+	// Seed the cache with the versions resolved by a previous leader so
+	// that we don't have to wait on the registry.
+	persisted := version.NewConfigMap(r.client, r.namespace, version.ConfigMapName(pool.Name))
+	persisted.Owner = metav1.NewControllerRef(pool, poolv1alpha1.GroupVersion.WithKind("Pool"))
+
+	if err := persisted.Load(ctx); err != nil {
+		log.Error(err, "failed to load persisted versions")
+	}
+
+	// The versions resolved from a previous source are not used.
+	persisted.Retain(source.Name())
+
+	resolverCtx, cancel := context.WithCancel(r.ctx)
+
+	res := &resolver{
+		key:       key,
+		persisted: persisted,
+		cache:     version.NewVersion(persisted),
+		cancel:    cancel,
+	}
+
+	r.resolvers[pool.Name] = res
+
+	go res.cache.Run(resolverCtx, source, channels)
+
+	log.Info("started version resolver", "source", source.Name())
+
+	return res, nil
+}
+
+// remove stops the resolver of a deleted pool.
+func (r *Resolvers) remove(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if res, ok := r.resolvers[name]; ok {
+		res.cancel()
+
+		delete(r.resolvers, name)
+	}
+}
+
+// sourceKey returns the fields of the pool's spec that configure its version
+// source.
+func sourceKey(pool *poolv1alpha1.Pool) (string, error) {
+	b, err := json.Marshal([]interface{}{
+		pool.Spec.Registry,
+		pool.Spec.Repository,
+		pool.Spec.Tags,
+		pool.Spec.Source,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,41 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package controllers
+
+import (
+	"context"
+	"errors"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
+	"github.com/talos-systems/talos-controller-manager/pkg/tracing"
+)
+
+// tracePhase records a span for the phase the node left, starting at the
+// transition into it. The phases span several reconciles, so this is how the
+// time spent rebooting or waiting for the node to become healthy shows up in
+// traces.
+func tracePhase(ctx context.Context, pool *poolv1alpha1.Pool, node *corev1.Node, phase string, since metav1.Time, s *poolv1alpha1.NodeStatus) {
+	if s.Phase == phase || phase == "" || since.IsZero() {
+		return
+	}
+
+	_, span := tracing.StartAt(ctx, "Phase "+phase, since.Time,
+		tracing.PoolKey.String(pool.Name),
+		tracing.NodeKey.String(node.Name),
+		tracing.PhaseKey.String(phase),
+		tracing.VersionKey.String(s.Version),
+		tracing.TargetVersionKey.String(s.TargetVersion),
+	)
+
+	var err error
+	if s.Phase == poolv1alpha1.NodeFailed {
+		err = errors.New(s.Message)
+	}
+
+	tracing.End(span, err)
+}
@@ -0,0 +1,102 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
+	"github.com/talos-systems/talos-controller-manager/pkg/tracing"
+)
+
+func TestTracePhase(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	pool := &poolv1alpha1.Pool{ObjectMeta: metav1.ObjectMeta{Name: "workers"}}
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-1"}}
+	since := metav1.NewTime(time.Now().Add(-time.Minute))
+
+	tests := []struct {
+		name   string
+		phase  string
+		status poolv1alpha1.NodeStatus
+		want   string
+		code   codes.Code
+	}{
+		{
+			name:   "rebooted",
+			phase:  poolv1alpha1.NodeUpgrading,
+			status: poolv1alpha1.NodeStatus{Phase: poolv1alpha1.NodeVerifying, TargetVersion: "v0.4.0"},
+			want:   "Phase Upgrading",
+			code:   codes.Unset,
+		},
+		{
+			name:   "unchanged",
+			phase:  poolv1alpha1.NodeVerifying,
+			status: poolv1alpha1.NodeStatus{Phase: poolv1alpha1.NodeVerifying},
+		},
+		{
+			name:   "failed",
+			phase:  poolv1alpha1.NodeVerifying,
+			status: poolv1alpha1.NodeStatus{Phase: poolv1alpha1.NodeFailed, Message: "health check failed"},
+			want:   "Phase Verifying",
+			code:   codes.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ended := len(recorder.Ended())
+
+			tracePhase(context.Background(), pool, node, tt.phase, since, &tt.status)
+
+			spans := recorder.Ended()[ended:]
+
+			if tt.want == "" {
+				if len(spans) != 0 {
+					t.Fatalf("recorded %d spans, want none", len(spans))
+				}
+
+				return
+			}
+
+			if len(spans) != 1 {
+				t.Fatalf("recorded %d spans, want 1", len(spans))
+			}
+
+			span := spans[0]
+
+			if span.Name() != tt.want {
+				t.Errorf("name = %q, want %q", span.Name(), tt.want)
+			}
+
+			if !span.StartTime().Equal(since.Time) {
+				t.Errorf("start = %v, want %v", span.StartTime(), since.Time)
+			}
+
+			if span.Status().Code != tt.code {
+				t.Errorf("status = %v, want %v", span.Status().Code, tt.code)
+			}
+
+			attrs := map[string]string{}
+			for _, kv := range span.Attributes() {
+				attrs[string(kv.Key)] = kv.Value.Emit()
+			}
+
+			if attrs[string(tracing.PoolKey)] != "workers" || attrs[string(tracing.NodeKey)] != "worker-1" || attrs[string(tracing.PhaseKey)] != tt.phase {
+				t.Errorf("attributes = %v", attrs)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package metrics defines the Prometheus metrics of the controller. They are
+// registered with the controller-runtime registry, and served on the
+// manager's metrics endpoint.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const namespace = "talos"
+
+// The results of an upgrade.
+const (
+	SucceededResult = "succeeded"
+	FailedResult    = "failed"
+)
+
+var (
+	// PhaseDuration is the time nodes spend in each phase of an upgrade.
+	PhaseDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upgrade_phase_duration_seconds",
+		Help:      "Time nodes spent in each phase of an upgrade.",
+		Buckets:   prometheus.ExponentialBuckets(10, 2, 10),
+	}, []string{"pool", "phase"})
+
+	// Upgrades counts the finished upgrades of nodes by result.
+	Upgrades = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upgrades_total",
+		Help:      "Number of node upgrades that finished, by result.",
+	}, []string{"pool", "result"})
+
+	// RegistryRequestDuration is the latency of the requests to registries.
+	RegistryRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "registry_request_duration_seconds",
+		Help:      "Latency of the requests to container registries.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"registry"})
+
+	// RegistryRequestErrors counts the requests to registries that failed,
+	// or were answered with a server error.
+	RegistryRequestErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "registry_request_errors_total",
+		Help:      "Number of requests to container registries that failed.",
+	}, []string{"registry"})
+
+	// ChannelResolved is the time each channel was last resolved.
+	ChannelResolved = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "channel_last_resolved_timestamp_seconds",
+		Help:      "Unix time of the last successful resolution of the channel.",
+	}, []string{"channel", "source"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		PhaseDuration,
+		Upgrades,
+		RegistryRequestDuration,
+		RegistryRequestErrors,
+		ChannelResolved,
+	)
+}
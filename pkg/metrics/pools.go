@@ -0,0 +1,92 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package metrics
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
+)
+
+var (
+	poolVersionDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "pool", "target_version_info"),
+		"The version the pool is upgraded to.",
+		[]string{"pool", "version"}, nil,
+	)
+	poolSizeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "pool", "size"),
+		"Number of nodes in the pool.",
+		[]string{"pool"}, nil,
+	)
+	poolInProgressDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "pool", "nodes_in_progress"),
+		"Number of nodes of the pool with an upgrade in progress.",
+		[]string{"pool"}, nil,
+	)
+	nodeVersionDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "version_info"),
+		"The Talos version the node runs.",
+		[]string{"pool", "node", "version"}, nil,
+	)
+)
+
+// PoolCollector collects the state of the pools and their nodes from the
+// pools' status at scrape time, so that no series are left behind for
+// deleted pools, removed nodes or previous versions.
+type PoolCollector struct {
+	Client client.Reader
+}
+
+// NewPoolCollector returns a collector of the pools read with the client.
+func NewPoolCollector(c client.Reader) *PoolCollector {
+	return &PoolCollector{Client: c}
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *PoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolVersionDesc
+	ch <- poolSizeDesc
+	ch <- poolInProgressDesc
+	ch <- nodeVersionDesc
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *PoolCollector) Collect(ch chan<- prometheus.Metric) {
+	var pools poolv1alpha1.PoolList
+
+	if err := c.Client.List(context.Background(), &pools); err != nil {
+		ch <- prometheus.NewInvalidMetric(poolSizeDesc, err)
+
+		return
+	}
+
+	for _, pool := range pools.Items {
+		if pool.Status.Version != "" {
+			ch <- prometheus.MustNewConstMetric(poolVersionDesc, prometheus.GaugeValue, 1, pool.Name, pool.Status.Version)
+		}
+
+		ch <- prometheus.MustNewConstMetric(poolSizeDesc, prometheus.GaugeValue, float64(pool.Status.Size), pool.Name)
+
+		inProgress := 0
+
+		for i := range pool.Status.Nodes {
+			s := &pool.Status.Nodes[i]
+
+			if s.InProgress() {
+				inProgress++
+			}
+
+			if s.Version != "" {
+				ch <- prometheus.MustNewConstMetric(nodeVersionDesc, prometheus.GaugeValue, 1, pool.Name, s.Name, s.Version)
+			}
+		}
+
+		ch <- prometheus.MustNewConstMetric(poolInProgressDesc, prometheus.GaugeValue, float64(inProgress), pool.Name)
+	}
+}
@@ -0,0 +1,56 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
+)
+
+func TestPoolCollector(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := poolv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	pool := &poolv1alpha1.Pool{ObjectMeta: metav1.ObjectMeta{Name: "workers"}}
+	pool.Status = poolv1alpha1.PoolStatus{
+		Size:    2,
+		Version: "v0.4.0",
+		Nodes: []poolv1alpha1.NodeStatus{
+			{Name: "worker-1", Phase: poolv1alpha1.NodeSucceeded, Version: "v0.4.0"},
+			{Name: "worker-2", Phase: poolv1alpha1.NodeUpgrading, Version: "v0.3.2"},
+		},
+	}
+
+	c := NewPoolCollector(fake.NewFakeClientWithScheme(scheme, pool))
+
+	want := `
+# HELP talos_node_version_info The Talos version the node runs.
+# TYPE talos_node_version_info gauge
+talos_node_version_info{node="worker-1",pool="workers",version="v0.4.0"} 1
+talos_node_version_info{node="worker-2",pool="workers",version="v0.3.2"} 1
+# HELP talos_pool_nodes_in_progress Number of nodes of the pool with an upgrade in progress.
+# TYPE talos_pool_nodes_in_progress gauge
+talos_pool_nodes_in_progress{pool="workers"} 1
+# HELP talos_pool_size Number of nodes in the pool.
+# TYPE talos_pool_size gauge
+talos_pool_size{pool="workers"} 2
+# HELP talos_pool_target_version_info The version the pool is upgraded to.
+# TYPE talos_pool_target_version_info gauge
+talos_pool_target_version_info{pool="workers",version="v0.4.0"} 1
+`
+
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
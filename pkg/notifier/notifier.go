@@ -0,0 +1,366 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package notifier posts the rollout events of pools to webhooks.
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
+)
+
+const (
+	// DefaultMaxRetries is the number of times a failed delivery is retried
+	// before giving up.
+	DefaultMaxRetries = 5
+
+	// DefaultBaseBackoff is the backoff before the first retry, doubled on
+	// every retry.
+	DefaultBaseBackoff = 2 * time.Second
+
+	// DefaultMaxBackoff caps the exponential backoff.
+	DefaultMaxBackoff = time.Minute
+
+	// DefaultTimeout is the timeout of each delivery attempt.
+	DefaultTimeout = 10 * time.Second
+
+	// DefaultQueueSize is the number of events queued for each webhook
+	// before new events are dropped.
+	DefaultQueueSize = 100
+)
+
+// Event is a rollout event of a pool.
+type Event struct {
+	Type            string    `json:"type"`
+	Pool            string    `json:"pool"`
+	Channel         string    `json:"channel,omitempty"`
+	Version         string    `json:"version,omitempty"`
+	PreviousVersion string    `json:"previousVersion,omitempty"`
+	Node            string    `json:"node,omitempty"`
+	Message         string    `json:"message"`
+	Time            time.Time `json:"time"`
+}
+
+// NewEvent returns an event of the pool, for the version it is upgraded to.
+func NewEvent(pool *poolv1alpha1.Pool, eventType, message string) Event {
+	return Event{
+		Type:    eventType,
+		Pool:    pool.Name,
+		Channel: pool.Spec.Channel,
+		Version: pool.Status.Version,
+		Message: message,
+		Time:    time.Now().UTC(),
+	}
+}
+
+// StatusError is returned when a webhook responds with an error status.
+type StatusError struct {
+	notification string
+	status       int
+}
+
+// NewStatusError returns an error for the notification's webhook responding
+// with the status.
+func NewStatusError(notification string, status int) StatusError {
+	return StatusError{notification: notification, status: status}
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("notification %q: webhook responded with %d %s", e.notification, e.status, http.StatusText(e.status))
+}
+
+// Temporary returns true if the delivery should be retried.
+func (e StatusError) Temporary() bool {
+	return e.status == http.StatusTooManyRequests || e.status >= http.StatusInternalServerError
+}
+
+// Notifier delivers the events of a pool to the webhooks of the pool's
+// notifications. Each webhook has a queue delivered in order in the
+// background, and failed deliveries are retried with an exponential backoff,
+// so that notifying never blocks the upgrades. Shutdown stops the deliveries.
+type Notifier struct {
+	// Client reads the Secrets holding webhook URLs, in the namespace.
+	Client    kubernetes.Interface
+	Namespace string
+
+	HTTPClient *http.Client
+
+	MaxRetries  int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+
+	QueueSize int
+
+	mu     sync.Mutex
+	queues map[string]chan delivery
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	log logr.Logger
+}
+
+// delivery is a queued event of a notification.
+type delivery struct {
+	notification poolv1alpha1.Notification
+	event        Event
+}
+
+// NewNotifier returns a notifier that reads the webhook URLs of
+// notifications from Secrets in the namespace.
+func NewNotifier(clientset kubernetes.Interface, namespace string) *Notifier {
+	return &Notifier{
+		Client:      clientset,
+		Namespace:   namespace,
+		HTTPClient:  &http.Client{Timeout: DefaultTimeout},
+		MaxRetries:  DefaultMaxRetries,
+		BaseBackoff: DefaultBaseBackoff,
+		MaxBackoff:  DefaultMaxBackoff,
+		QueueSize:   DefaultQueueSize,
+		log:         ctrl.Log.WithName("notifier"),
+	}
+}
+
+// Notify delivers the event to the pool's notifications that subscribe to it.
+func (n *Notifier) Notify(pool *poolv1alpha1.Pool, e Event) {
+	for _, notification := range pool.Spec.Notifications {
+		if !subscribed(notification, e.Type) {
+			continue
+		}
+
+		n.enqueue(pool.Name+"/"+notification.Name, delivery{notification: *notification.DeepCopy(), event: e})
+	}
+}
+
+// Shutdown cancels the deliveries in flight, drops the queued ones, and
+// blocks until the workers have exited. Events notified after Shutdown are
+// dropped.
+func (n *Notifier) Shutdown() {
+	n.mu.Lock()
+	n.init()
+	n.cancel()
+	n.mu.Unlock()
+
+	n.wg.Wait()
+}
+
+// init initializes the queues and the context cancelled by Shutdown. The
+// lock must be held.
+func (n *Notifier) init() {
+	if n.queues == nil {
+		n.queues = map[string]chan delivery{}
+	}
+
+	if n.ctx == nil {
+		n.ctx, n.cancel = context.WithCancel(context.Background())
+	}
+}
+
+// enqueue queues the delivery for the webhook, starting the webhook's worker
+// if it is idle.
+func (n *Notifier) enqueue(key string, d delivery) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.init()
+
+	if n.ctx.Err() != nil {
+		n.log.Info("dropping notification, the notifier is shut down", "notification", d.notification.Name, "pool", d.event.Pool, "event", d.event.Type)
+
+		return
+	}
+
+	queue, ok := n.queues[key]
+	if !ok {
+		size := n.QueueSize
+		if size <= 0 {
+			size = DefaultQueueSize
+		}
+
+		queue = make(chan delivery, size)
+		n.queues[key] = queue
+
+		n.wg.Add(1)
+
+		go n.work(n.ctx, key, queue)
+	}
+
+	select {
+	case queue <- d:
+	default:
+		n.log.Info("dropping notification, the queue is full", "notification", d.notification.Name, "pool", d.event.Pool, "event", d.event.Type)
+	}
+}
+
+// work delivers the queued events in order, and exits once the queue is
+// empty, or the context is cancelled.
+func (n *Notifier) work(ctx context.Context, key string, queue chan delivery) {
+	defer n.wg.Done()
+
+	for {
+		n.mu.Lock()
+
+		if ctx.Err() != nil {
+			delete(n.queues, key)
+			n.mu.Unlock()
+
+			if len(queue) > 0 {
+				n.log.Info("dropping queued notifications, the notifier is shut down", "queue", key, "count", len(queue))
+			}
+
+			return
+		}
+
+		select {
+		case d := <-queue:
+			n.mu.Unlock()
+
+			n.deliver(ctx, d.notification, d.event)
+		default:
+			delete(n.queues, key)
+			n.mu.Unlock()
+
+			return
+		}
+	}
+}
+
+func (n *Notifier) deliver(ctx context.Context, notification poolv1alpha1.Notification, e Event) {
+	body, err := Payload(notification, e)
+	if err != nil {
+		n.log.Error(err, "failed to render notification", "notification", notification.Name, "pool", e.Pool, "event", e.Type)
+
+		return
+	}
+
+	for attempt := 0; ; attempt++ {
+		err = n.post(ctx, notification, body)
+		if err == nil {
+			return
+		}
+
+		if ctx.Err() != nil {
+			n.log.Info("notification cancelled", "notification", notification.Name, "pool", e.Pool, "event", e.Type)
+
+			return
+		}
+
+		if !temporary(err) || attempt >= n.MaxRetries {
+			n.log.Error(err, "failed to deliver notification", "notification", notification.Name, "pool", e.Pool, "event", e.Type)
+
+			return
+		}
+
+		backoff := n.backoff(attempt)
+
+		n.log.Info("retrying notification", "notification", notification.Name, "pool", e.Pool, "event", e.Type, "after", backoff, "error", err.Error())
+
+		timer := time.NewTimer(backoff)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			n.log.Info("notification cancelled", "notification", notification.Name, "pool", e.Pool, "event", e.Type)
+
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func (n *Notifier) post(ctx context.Context, notification poolv1alpha1.Notification, body []byte) error {
+	url, err := n.url(notification)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	// nolint: errcheck
+	io.Copy(ioutil.Discard, resp.Body)
+	// nolint: errcheck
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return NewStatusError(notification.Name, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// url returns the webhook's URL, read from the Secret if it is referenced.
+func (n *Notifier) url(notification poolv1alpha1.Notification) (string, error) {
+	if notification.URLFrom == nil {
+		return notification.URL, nil
+	}
+
+	secret, err := n.Client.CoreV1().Secrets(n.Namespace).Get(notification.URLFrom.Name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get the URL of notification %q: %w", notification.Name, err)
+	}
+
+	url, ok := secret.Data[notification.URLFrom.Key]
+	if !ok {
+		return "", fmt.Errorf("secret %q has no key %q", notification.URLFrom.Name, notification.URLFrom.Key)
+	}
+
+	return string(url), nil
+}
+
+func (n *Notifier) backoff(attempt int) time.Duration {
+	d := n.BaseBackoff << uint(attempt)
+	if d <= 0 || d > n.MaxBackoff {
+		d = n.MaxBackoff
+	}
+
+	return d
+}
+
+// temporary returns true for errors other than a webhook rejecting the
+// notification.
+func temporary(err error) bool {
+	if e, ok := err.(StatusError); ok {
+		return e.Temporary()
+	}
+
+	return true
+}
+
+func subscribed(notification poolv1alpha1.Notification, eventType string) bool {
+	if len(notification.Events) == 0 {
+		return true
+	}
+
+	for _, e := range notification.Events {
+		if e == eventType {
+			return true
+		}
+	}
+
+	return false
+}
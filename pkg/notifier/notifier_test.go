@@ -0,0 +1,187 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
+)
+
+func TestDeliver(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		want     int
+	}{
+		{
+			name:     "delivered",
+			statuses: []int{http.StatusOK},
+			want:     1,
+		},
+		{
+			name:     "retried",
+			statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusNoContent},
+			want:     3,
+		},
+		{
+			name:     "rejected",
+			statuses: []int{http.StatusBadRequest, http.StatusOK},
+			want:     1,
+		},
+		{
+			name:     "given up",
+			statuses: []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusOK},
+			want:     3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.statuses[requests])
+				requests++
+			}))
+			defer server.Close()
+
+			clientset := fake.NewSimpleClientset(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "webhooks", Namespace: "talos-system"},
+				Data:       map[string][]byte{"url": []byte(server.URL)},
+			})
+
+			n := NewNotifier(clientset, "talos-system")
+			n.MaxRetries = 2
+			n.BaseBackoff = time.Millisecond
+
+			notification := poolv1alpha1.Notification{
+				Name:    "webhook",
+				URLFrom: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "webhooks"}, Key: "url"},
+			}
+
+			n.deliver(context.Background(), notification, Event{Type: poolv1alpha1.RolloutStartedEvent, Pool: "workers"})
+
+			if requests != tt.want {
+				t.Errorf("requests = %d, want %d", requests, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotifyOrder(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []string
+	)
+
+	done := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e Event
+
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Errorf("failed to decode event: %v", err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		received = append(received, e.Node)
+		if len(received) == 3 {
+			close(done)
+		}
+	}))
+	defer server.Close()
+
+	n := NewNotifier(fake.NewSimpleClientset(), "talos-system")
+
+	pool := &poolv1alpha1.Pool{
+		ObjectMeta: metav1.ObjectMeta{Name: "workers"},
+		Spec: poolv1alpha1.PoolSpec{
+			Notifications: []poolv1alpha1.Notification{{Name: "webhook", URL: server.URL}},
+		},
+	}
+
+	for _, node := range []string{"a", "b", "c"} {
+		n.Notify(pool, Event{Type: poolv1alpha1.RolloutStartedEvent, Pool: "workers", Node: node})
+	}
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the notifications")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for i, want := range []string{"a", "b", "c"} {
+		if received[i] != want {
+			t.Errorf("received[%d] = %q, want %q", i, received[i], want)
+		}
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	requested := make(chan struct{}, 10)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		requested <- struct{}{}
+	}))
+	defer server.Close()
+
+	n := NewNotifier(fake.NewSimpleClientset(), "talos-system")
+	n.BaseBackoff = time.Hour
+	n.MaxBackoff = time.Hour
+
+	pool := &poolv1alpha1.Pool{
+		ObjectMeta: metav1.ObjectMeta{Name: "workers"},
+		Spec: poolv1alpha1.PoolSpec{
+			Notifications: []poolv1alpha1.Notification{{Name: "webhook", URL: server.URL}},
+		},
+	}
+
+	n.Notify(pool, Event{Type: poolv1alpha1.RolloutStartedEvent, Pool: "workers", Node: "a"})
+	n.Notify(pool, Event{Type: poolv1alpha1.RolloutStartedEvent, Pool: "workers", Node: "b"})
+
+	select {
+	case <-requested:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the notification")
+	}
+
+	// The first delivery is backing off, and the second is queued.
+	done := make(chan struct{})
+
+	go func() {
+		n.Shutdown()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Shutdown() did not return during the backoff")
+	}
+
+	n.Notify(pool, Event{Type: poolv1alpha1.RolloutStartedEvent, Pool: "workers", Node: "c"})
+
+	select {
+	case <-requested:
+		t.Error("notification delivered after Shutdown()")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
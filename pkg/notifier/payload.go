@@ -0,0 +1,104 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"text/template"
+	"time"
+
+	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
+)
+
+// slackMessage is the payload of Slack incoming webhooks.
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+// alert is an alert of the Alertmanager API.
+type alert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    time.Time         `json:"startsAt"`
+}
+
+// Validate returns an error if the payload of a notification can not be
+// rendered, because of an invalid template or format.
+func Validate(notifications []poolv1alpha1.Notification) error {
+	e := Event{
+		Type:    poolv1alpha1.RolloutStartedEvent,
+		Pool:    "pool",
+		Version: "v0.0.0",
+		Message: "message",
+		Time:    time.Now().UTC(),
+	}
+
+	for _, notification := range notifications {
+		if _, err := Payload(notification, e); err != nil {
+			return fmt.Errorf("notification %q: %w", notification.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Payload returns the body of the notification of the event.
+func Payload(notification poolv1alpha1.Notification, e Event) ([]byte, error) {
+	message := e.Message
+
+	if notification.Template != "" {
+		t, err := template.New(notification.Name).Parse(notification.Template)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template: %w", err)
+		}
+
+		var buf bytes.Buffer
+
+		if err = t.Execute(&buf, e); err != nil {
+			return nil, fmt.Errorf("failed to render template: %w", err)
+		}
+
+		message = buf.String()
+	}
+
+	switch notification.Format {
+	case "", poolv1alpha1.GenericFormat:
+		if notification.Template != "" {
+			if !json.Valid([]byte(message)) {
+				return nil, fmt.Errorf("template did not render valid JSON: %q", message)
+			}
+
+			return []byte(message), nil
+		}
+
+		return json.Marshal(e)
+	case poolv1alpha1.SlackFormat:
+		return json.Marshal(slackMessage{Text: message})
+	case poolv1alpha1.AlertmanagerFormat:
+		severity := "info"
+		if e.Type == poolv1alpha1.RolloutPausedEvent {
+			severity = "warning"
+		}
+
+		return json.Marshal([]alert{
+			{
+				Labels: map[string]string{
+					"alertname": "TalosPool" + e.Type,
+					"pool":      e.Pool,
+					"version":   e.Version,
+					"severity":  severity,
+				},
+				Annotations: map[string]string{
+					"summary": message,
+				},
+				StartsAt: e.Time,
+			},
+		})
+	default:
+		return nil, fmt.Errorf("unknown notification format %q", notification.Format)
+	}
+}
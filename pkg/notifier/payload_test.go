@@ -0,0 +1,76 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package notifier
+
+import (
+	"testing"
+	"time"
+
+	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
+)
+
+func TestPayload(t *testing.T) {
+	e := Event{
+		Type:    poolv1alpha1.RolloutPausedEvent,
+		Pool:    "workers",
+		Version: "v0.4.0",
+		Message: "paused",
+		Time:    time.Date(2020, 1, 22, 0, 0, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		name         string
+		notification poolv1alpha1.Notification
+		want         string
+		wantErr      bool
+	}{
+		{
+			name: "generic",
+			want: `{"type":"RolloutPaused","pool":"workers","version":"v0.4.0","message":"paused","time":"2020-01-22T00:00:00Z"}`,
+		},
+		{
+			name:         "generic template",
+			notification: poolv1alpha1.Notification{Template: `{"pool":"{{ .Pool }}","version":"{{ .Version }}"}`},
+			want:         `{"pool":"workers","version":"v0.4.0"}`,
+		},
+		{
+			name:         "slack",
+			notification: poolv1alpha1.Notification{Format: poolv1alpha1.SlackFormat, Template: "{{ .Pool }}: {{ .Message }}"},
+			want:         `{"text":"workers: paused"}`,
+		},
+		{
+			name:         "alertmanager",
+			notification: poolv1alpha1.Notification{Format: poolv1alpha1.AlertmanagerFormat},
+			want:         `[{"labels":{"alertname":"TalosPoolRolloutPaused","pool":"workers","severity":"warning","version":"v0.4.0"},"annotations":{"summary":"paused"},"startsAt":"2020-01-22T00:00:00Z"}]`,
+		},
+		{
+			name:         "invalid template",
+			notification: poolv1alpha1.Notification{Template: "{{ .Pool"},
+			wantErr:      true,
+		},
+		{
+			name:         "invalid JSON",
+			notification: poolv1alpha1.Notification{Template: "{{ .Pool }} is {{ .Version }}"},
+			wantErr:      true,
+		},
+		{
+			name:         "unknown format",
+			notification: poolv1alpha1.Notification{Format: "Teams"},
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Payload(tt.notification, e)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Payload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if string(got) != tt.want {
+				t.Errorf("Payload() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/client"
+	digest "github.com/opencontainers/go-digest"
+)
+
+const (
+	MediaTypeOCIManifest = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex    = "application/vnd.oci.image.index.v1+json"
+)
+
+// ErrNotFound is returned when a manifest does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Descriptor is an OCI content descriptor.
+type Descriptor struct {
+	MediaType    string            `json:"mediaType"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Digest       digest.Digest     `json:"digest"`
+	Size         int64             `json:"size"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+// OCIManifest is an OCI image manifest, or an OCI index when listing
+// referrers.
+type OCIManifest struct {
+	MediaType    string       `json:"mediaType"`
+	ArtifactType string       `json:"artifactType,omitempty"`
+	Config       Descriptor   `json:"config"`
+	Layers       []Descriptor `json:"layers"`
+	Manifests    []Descriptor `json:"manifests,omitempty"`
+}
+
+// Image is a parsed image reference.
+type Image struct {
+	// Registry is the base URL of the registry.
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     digest.Digest
+}
+
+// ParseImage parses an image reference (e.g. docker.io/autonomy/installer:v0.3.0).
+func ParseImage(image string) (*Image, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return nil, err
+	}
+
+	i := &Image{
+		Registry:   "https://" + reference.Domain(named),
+		Repository: reference.Path(named),
+	}
+
+	if reference.Domain(named) == "docker.io" {
+		i.Registry = "https://registry-1.docker.io"
+	}
+
+	if tagged, ok := named.(reference.Tagged); ok {
+		i.Tag = tagged.Tag()
+	}
+
+	if canonical, ok := named.(reference.Canonical); ok {
+		i.Digest = canonical.Digest()
+	}
+
+	if i.Tag == "" && i.Digest == "" {
+		i.Tag = "latest"
+	}
+
+	return i, nil
+}
+
+// ImageDigest returns the digest of the image, resolving its tag if the
+// reference is not pinned to a digest.
+func ImageDigest(ctx context.Context, image string) (digest.Digest, error) {
+	img, err := ParseImage(image)
+	if err != nil {
+		return "", err
+	}
+
+	if img.Digest != "" {
+		return img.Digest, nil
+	}
+
+	repo, err := New(ctx, img.Registry, img.Repository)
+	if err != nil {
+		return "", err
+	}
+
+	dgst, err := repo.Digest(ctx, img.Tag)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve digest of %q: %w", image, err)
+	}
+
+	return dgst, nil
+}
+
+// PinImage returns the image reference pinned to the digest, without its
+// tag (e.g. docker.io/autonomy/installer@sha256:...).
+func PinImage(image string, dgst digest.Digest) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", err
+	}
+
+	pinned, err := reference.WithDigest(reference.TrimNamed(named), dgst)
+	if err != nil {
+		return "", err
+	}
+
+	return pinned.String(), nil
+}
+
+// OCIManifest fetches the manifest for the tag or digest.
+func (r *Repository) OCIManifest(ctx context.Context, ref string) (*OCIManifest, error) {
+	ub, err := v2.NewURLBuilderFromString(r.base, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var named reference.Named
+
+	if dgst, err := digest.Parse(ref); err == nil {
+		named, err = reference.WithDigest(r.repository.Named(), dgst)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		named, err = reference.WithTag(r.repository.Named(), ref)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	u, err := ub.BuildManifestURL(named)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.getOCIManifest(ctx, u, MediaTypeOCIManifest)
+}
+
+// Referrers lists the manifests that refer to the digest using the OCI
+// referrers API.
+func (r *Repository) Referrers(ctx context.Context, dgst digest.Digest) ([]Descriptor, error) {
+	u := fmt.Sprintf("%s/v2/%s/referrers/%s", strings.TrimSuffix(r.base, "/"), r.repository.Named().Name(), dgst)
+
+	index, err := r.getOCIManifest(ctx, u, MediaTypeOCIIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	return index.Manifests, nil
+}
+
+// Blob fetches the blob with the digest.
+func (r *Repository) Blob(ctx context.Context, dgst digest.Digest) ([]byte, error) {
+	return r.repository.Blobs(ctx).Get(ctx, dgst)
+}
+
+func (r *Repository) getOCIManifest(ctx context.Context, u, accept string) (*OCIManifest, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", accept)
+
+	resp, err := (&http.Client{Transport: r.transport}).Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	// nolint: errcheck
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+
+	if !client.SuccessStatus(resp.StatusCode) {
+		return nil, client.HandleErrorResponse(resp)
+	}
+
+	m := &OCIManifest{}
+	if err = json.NewDecoder(resp.Body).Decode(m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
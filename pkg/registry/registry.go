@@ -11,6 +11,7 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"sync"
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/manifest/schema2"
@@ -19,13 +20,35 @@ import (
 	"github.com/docker/distribution/registry/client/auth"
 	"github.com/docker/distribution/registry/client/auth/challenge"
 	"github.com/docker/distribution/registry/client/transport"
+	lru "github.com/hashicorp/golang-lru"
 	digest "github.com/opencontainers/go-digest"
 )
 
 type Repository struct {
 	repository distribution.Repository
+
+	base      string
+	transport http.RoundTripper
+
+	// Manifests and blobs are content addressable, so they can be cached by
+	// digest. The least recently used are evicted.
+	configurations *lru.Cache
+	references     *lru.Cache
 }
 
+// digestCacheSize is the number of configurations, and of manifest
+// references, cached per repository.
+const digestCacheSize = 64
+
+// MaxRepositories is the number of repository clients kept for reuse. The
+// least recently used clients are evicted.
+const MaxRepositories = 64
+
+var (
+	repositories   *lru.Cache
+	repositoriesMu sync.Mutex
+)
+
 type CredentialStore struct {
 	username      string
 	password      string
@@ -52,8 +75,13 @@ func (c *CredentialStore) SetRefreshToken(u *url.URL, service string, token stri
 
 // ping pings the provided endpoint to determine its required authorization challenges.
 // If a version header is provided, the versions will be returned.
-func Ping(manager challenge.Manager, endpoint, versionHeader string) ([]auth.APIVersion, error) {
-	resp, err := http.Get(endpoint)
+func Ping(ctx context.Context, manager challenge.Manager, rt http.RoundTripper, endpoint, versionHeader string) ([]auth.APIVersion, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := (&http.Client{Transport: rt}).Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -66,18 +94,71 @@ func Ping(manager challenge.Manager, endpoint, versionHeader string) ([]auth.API
 	return auth.APIVersions(resp, versionHeader), err
 }
 
-func New(base, name string) (*Repository, error) {
+// New returns a client for the repository. Clients are reused across calls
+// so that the registry is only pinged once, and so that cached responses and
+// rate limits are shared. The registry is pinged without holding the lock, so
+// that a slow registry does not hold back the clients of the others.
+func New(ctx context.Context, base, name string) (*Repository, error) {
+	key := base + "/" + name
+
+	repositoriesMu.Lock()
+
+	if repositories == nil {
+		cache, err := lru.New(MaxRepositories)
+		if err != nil {
+			repositoriesMu.Unlock()
+
+			return nil, err
+		}
+
+		repositories = cache
+	}
+
+	cached, ok := repositories.Get(key)
+
+	repositoriesMu.Unlock()
+
+	if ok {
+		return cached.(*Repository), nil
+	}
+
+	r, err := newRepository(ctx, base, name)
+	if err != nil {
+		return nil, err
+	}
+
+	repositoriesMu.Lock()
+	defer repositoriesMu.Unlock()
+
+	// Another caller may have created a client while we pinged.
+	if cached, ok := repositories.Get(key); ok {
+		return cached.(*Repository), nil
+	}
+
+	repositories.Add(key, r)
+
+	return r, nil
+}
+
+func newRepository(ctx context.Context, base, name string) (*Repository, error) {
 	ref, err := reference.WithName(name)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	conditional, err := NewConditionalTransport(NewMetricsTransport(http.DefaultTransport))
+	if err != nil {
+		return nil, err
+	}
+
+	rt := NewRateLimitTransport(conditional)
+
 	manager := challenge.NewSimpleManager()
-	handler := auth.NewTokenHandler(http.DefaultTransport, &CredentialStore{}, ref.Name(), "pull")
+	handler := auth.NewTokenHandler(rt, &CredentialStore{}, ref.Name(), "pull")
 	authorizer := auth.NewAuthorizer(manager, handler)
-	transport := transport.NewTransport(http.DefaultTransport, authorizer)
+	transport := transport.NewTransport(rt, authorizer)
 
-	versions, err := Ping(manager, base+"/v2/", "Docker-Distribution-Api-Version")
+	versions, err := Ping(ctx, manager, rt, base+"/v2/", "Docker-Distribution-Api-Version")
 	if err != nil {
 		return nil, err
 	}
@@ -89,8 +170,29 @@ func New(base, name string) (*Repository, error) {
 	}
 
 	r, err := client.NewRepository(ref, base, transport)
+	if err != nil {
+		return nil, err
+	}
+
+	configurations, err := lru.New(digestCacheSize)
+	if err != nil {
+		return nil, err
+	}
+
+	references, err := lru.New(digestCacheSize)
+	if err != nil {
+		return nil, err
+	}
+
+	repo := &Repository{
+		repository:     r,
+		base:           base,
+		transport:      transport,
+		configurations: configurations,
+		references:     references,
+	}
 
-	return &Repository{r}, nil
+	return repo, nil
 }
 
 type Configuration struct {
@@ -99,10 +201,14 @@ type Configuration struct {
 	} `json:"config"`
 }
 
-func (r *Repository) Configuration(dgst digest.Digest) (*Configuration, error) {
-	blobs := r.repository.Blobs(context.Background())
+func (r *Repository) Configuration(ctx context.Context, dgst digest.Digest) (*Configuration, error) {
+	if cached, ok := r.configurations.Get(dgst); ok {
+		return cached.(*Configuration), nil
+	}
+
+	blobs := r.repository.Blobs(ctx)
 
-	b, err := blobs.Get(context.Background(), dgst)
+	b, err := blobs.Get(ctx, dgst)
 	if err != nil {
 		return nil, err
 	}
@@ -112,22 +218,29 @@ func (r *Repository) Configuration(dgst digest.Digest) (*Configuration, error) {
 		return nil, err
 	}
 
+	r.configurations.Add(dgst, m)
+
 	return m, nil
 }
 
-func (r *Repository) Manifest(tag string) (*distribution.Descriptor, error) {
-	tags := r.repository.Tags(context.Background())
-	descriptor, err := tags.Get(context.Background(), tag)
+func (r *Repository) Manifest(ctx context.Context, tag string) (*distribution.Descriptor, error) {
+	tags := r.repository.Tags(ctx)
+	descriptor, err := tags.Get(ctx, tag)
 	if err != nil {
 		return nil, err
 	}
 
-	manifests, err := r.repository.Manifests(context.Background())
+	// The tag has not moved since we last fetched its manifest.
+	if cached, ok := r.references.Get(descriptor.Digest); ok {
+		return cached.(*distribution.Descriptor), nil
+	}
+
+	manifests, err := r.repository.Manifests(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	manifest, err := manifests.Get(context.Background(), descriptor.Digest, distribution.WithTagOption{Tag: tag}, distribution.WithManifestMediaTypesOption{MediaTypes: []string{schema2.MediaTypeManifest}})
+	manifest, err := manifests.Get(ctx, descriptor.Digest, distribution.WithTagOption{Tag: tag}, distribution.WithManifestMediaTypesOption{MediaTypes: []string{schema2.MediaTypeManifest}})
 	if err != nil {
 		return nil, err
 	}
@@ -136,12 +249,32 @@ func (r *Repository) Manifest(tag string) (*distribution.Descriptor, error) {
 		return nil, fmt.Errorf("expected at least 1 manifest")
 	}
 
-	return &manifest.References()[0], nil
+	ref := manifest.References()[0]
+
+	r.references.Add(descriptor.Digest, &ref)
+
+	return &ref, nil
 }
 
-func (r *Repository) Tags() ([]string, error) {
-	tags := r.repository.Tags(context.Background())
-	all, err := tags.All(context.Background())
+// Digest returns the digest of the manifest that the tag points to.
+func (r *Repository) Digest(ctx context.Context, tag string) (digest.Digest, error) {
+	tags := r.repository.Tags(ctx)
+	descriptor, err := tags.Get(ctx, tag)
+	if err != nil {
+		return "", err
+	}
+
+	return descriptor.Digest, nil
+}
+
+func (r *Repository) Tags(ctx context.Context, setters ...TagsOption) ([]string, error) {
+	var all []string
+
+	err := r.TagPages(ctx, func(page []string) error {
+		all = append(all, page...)
+
+		return nil
+	}, setters...)
 	if err != nil {
 		return nil, err
 	}
@@ -149,8 +282,8 @@ func (r *Repository) Tags() ([]string, error) {
 	return all, nil
 }
 
-func (r *Repository) Tag(filter TagFilter) (string, error) {
-	all, err := r.Tags()
+func (r *Repository) Tag(ctx context.Context, filter TagFilter) (string, error) {
+	all, err := r.Tags(ctx)
 	if err != nil {
 		return "", err
 	}
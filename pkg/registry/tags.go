@@ -0,0 +1,211 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/client"
+)
+
+const (
+	// DefaultTagsPageSize is the number of tags requested per page.
+	DefaultTagsPageSize = 100
+)
+
+// ErrStopPaging can be returned by a page handler to stop listing tags
+// without an error.
+var ErrStopPaging = errors.New("stop paging")
+
+type TagsOptions struct {
+	// PageSize is the number of tags requested per page.
+	PageSize int
+	// Limit is the maximum number of tags listed. A value of zero means no
+	// limit.
+	Limit int
+	// Prefix restricts the listing to tags with the prefix. Since tags are
+	// listed in lexical order, the listing starts at the prefix and stops as
+	// soon as the tags no longer match it.
+	Prefix string
+}
+
+type TagsOption func(*TagsOptions)
+
+func WithPageSize(n int) TagsOption {
+	return func(opts *TagsOptions) {
+		opts.PageSize = n
+	}
+}
+
+func WithLimit(n int) TagsOption {
+	return func(opts *TagsOptions) {
+		opts.Limit = n
+	}
+}
+
+func WithPrefix(prefix string) TagsOption {
+	return func(opts *TagsOptions) {
+		opts.Prefix = prefix
+	}
+}
+
+func NewTagsOptions(setters ...TagsOption) *TagsOptions {
+	opts := &TagsOptions{
+		PageSize: DefaultTagsPageSize,
+	}
+
+	for _, setter := range setters {
+		setter(opts)
+	}
+
+	if opts.PageSize <= 0 {
+		opts.PageSize = DefaultTagsPageSize
+	}
+
+	return opts
+}
+
+// TagPages lists the repository's tags a page at a time using the
+// /v2/<name>/tags/list?n=&last= API, calling fn for each page.
+func (r *Repository) TagPages(ctx context.Context, fn func([]string) error, setters ...TagsOption) error {
+	opts := NewTagsOptions(setters...)
+
+	ub, err := v2.NewURLBuilderFromString(r.base, false)
+	if err != nil {
+		return err
+	}
+
+	s, err := ub.BuildTagsURL(r.repository.Named())
+	if err != nil {
+		return err
+	}
+
+	base, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+
+	c := &http.Client{Transport: r.transport}
+
+	last := before(opts.Prefix)
+	count := 0
+
+	for {
+		u := *base
+
+		q := u.Query()
+		q.Set("n", strconv.Itoa(opts.PageSize))
+
+		if last != "" {
+			q.Set("last", last)
+		}
+
+		u.RawQuery = q.Encode()
+
+		tags, more, err := r.tagsPage(ctx, c, u.String())
+		if err != nil {
+			return err
+		}
+
+		if len(tags) == 0 {
+			return nil
+		}
+
+		last = tags[len(tags)-1]
+
+		page := make([]string, 0, len(tags))
+
+		for _, tag := range tags {
+			if !strings.HasPrefix(tag, opts.Prefix) {
+				if opts.Prefix != "" && tag > opts.Prefix {
+					// We are past the tags with the prefix.
+					more = false
+
+					break
+				}
+
+				continue
+			}
+
+			if opts.Limit > 0 && count >= opts.Limit {
+				more = false
+
+				break
+			}
+
+			page = append(page, tag)
+			count++
+		}
+
+		if len(page) > 0 {
+			if err = fn(page); err != nil {
+				if err == ErrStopPaging {
+					return nil
+				}
+
+				return err
+			}
+		}
+
+		if !more {
+			return nil
+		}
+	}
+}
+
+func (r *Repository) tagsPage(ctx context.Context, c *http.Client, u string) (tags []string, more bool, err error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, false, err
+	}
+
+	// nolint: errcheck
+	defer resp.Body.Close()
+
+	if !client.SuccessStatus(resp.StatusCode) {
+		return nil, false, client.HandleErrorResponse(resp)
+	}
+
+	page := struct {
+		Tags []string `json:"tags"`
+	}{}
+
+	if err = json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, false, err
+	}
+
+	// Registries that support pagination advertise the next page with a Link
+	// header.
+	return page.Tags, resp.Header.Get("Link") != "", nil
+}
+
+// before returns a string that sorts immediately before the prefix so that
+// it can be used as the starting point of a listing.
+func before(prefix string) string {
+	if prefix == "" {
+		return ""
+	}
+
+	b := []byte(prefix)
+	if b[len(b)-1] == 0 {
+		return string(b[:len(b)-1])
+	}
+
+	b[len(b)-1]--
+
+	return string(b)
+}
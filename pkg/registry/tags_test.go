@@ -0,0 +1,114 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func newTestRegistry(t *testing.T, tags []string) *httptest.Server {
+	sort.Strings(tags)
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/v2/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Docker-Distribution-Api-Version", "registry/2.0")
+	})
+
+	mux.HandleFunc("/v2/test/installer/tags/list", func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.Atoi(r.URL.Query().Get("n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		last := r.URL.Query().Get("last")
+
+		page := []string{}
+
+		for _, tag := range tags {
+			if tag > last && len(page) < n {
+				page = append(page, tag)
+			}
+		}
+
+		if len(page) > 0 && page[len(page)-1] != tags[len(tags)-1] {
+			w.Header().Set("Link", `</v2/test/installer/tags/list?n=`+strconv.Itoa(n)+`&last=`+page[len(page)-1]+`>; rel="next"`)
+		}
+
+		// nolint: errcheck
+		json.NewEncoder(w).Encode(map[string]interface{}{"name": "test/installer", "tags": page})
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestRepositoryTagPages(t *testing.T) {
+	server := newTestRegistry(t, []string{"latest", "edge", "v0.1.0", "v0.2.0", "v0.3.0", "v0.4.0", "x"})
+	defer server.Close()
+
+	repo, err := newRepository(context.Background(), server.URL, "test/installer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		setters   []TagsOption
+		wantTags  []string
+		wantPages int
+	}{
+		{
+			name:      "all",
+			setters:   []TagsOption{WithPageSize(2)},
+			wantTags:  []string{"edge", "latest", "v0.1.0", "v0.2.0", "v0.3.0", "v0.4.0", "x"},
+			wantPages: 4,
+		},
+		{
+			name:      "limit",
+			setters:   []TagsOption{WithPageSize(2), WithLimit(3)},
+			wantTags:  []string{"edge", "latest", "v0.1.0"},
+			wantPages: 2,
+		},
+		{
+			name:      "prefix",
+			setters:   []TagsOption{WithPageSize(3), WithPrefix("v")},
+			wantTags:  []string{"v0.1.0", "v0.2.0", "v0.3.0", "v0.4.0"},
+			wantPages: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				tags  []string
+				pages int
+			)
+
+			err := repo.TagPages(context.Background(), func(page []string) error {
+				tags = append(tags, page...)
+				pages++
+
+				return nil
+			}, tt.setters...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(tags, tt.wantTags) {
+				t.Errorf("TagPages() tags = %v, want %v", tags, tt.wantTags)
+			}
+
+			if pages != tt.wantPages {
+				t.Errorf("TagPages() pages = %d, want %d", pages, tt.wantPages)
+			}
+		})
+	}
+}
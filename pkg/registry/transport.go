@@ -0,0 +1,333 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package registry
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/talos-systems/talos-controller-manager/pkg/metrics"
+)
+
+const (
+	// DefaultMaxRetries is the number of times a rate limited request is
+	// retried before giving up.
+	DefaultMaxRetries = 5
+
+	// DefaultBaseBackoff is the initial backoff used when the registry does
+	// not specify a Retry-After header.
+	DefaultBaseBackoff = time.Second
+
+	// DefaultMaxBackoff caps the exponential backoff.
+	DefaultMaxBackoff = 2 * time.Minute
+
+	// DefaultMaxCachedResponses is the number of responses kept by the
+	// ConditionalTransport.
+	DefaultMaxCachedResponses = 256
+)
+
+// RateLimitTransport retries requests that have been rate limited by the
+// registry. The Retry-After header is honoured when present, otherwise an
+// exponential backoff is used. When the registry reports via the
+// RateLimit-Remaining header that the quota is spent, subsequent requests are
+// held back until the quota resets, as reported by the RateLimit-Reset header
+// or the window of the RateLimit-Limit header, or else until the backoff
+// elapses.
+type RateLimitTransport struct {
+	Transport http.RoundTripper
+
+	MaxRetries  int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+
+	mu    sync.Mutex
+	until time.Time
+}
+
+func NewRateLimitTransport(rt http.RoundTripper) *RateLimitTransport {
+	return &RateLimitTransport{
+		Transport:   rt,
+		MaxRetries:  DefaultMaxRetries,
+		BaseBackoff: DefaultBaseBackoff,
+		MaxBackoff:  DefaultMaxBackoff,
+	}
+}
+
+func (t *RateLimitTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	for attempt := 0; ; attempt++ {
+		if err = t.wait(req.Context()); err != nil {
+			return nil, err
+		}
+
+		resp, err = t.Transport.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+
+		backoff := t.backoff(attempt)
+
+		if remaining, ok := rateLimitRemaining(resp.Header); ok && remaining == 0 {
+			if reset, ok := rateLimitReset(resp.Header); ok {
+				t.holdFor(reset)
+			} else {
+				t.holdFor(backoff)
+			}
+		}
+
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+			return resp, nil
+		}
+
+		// Requests with a body cannot be safely replayed.
+		if req.Body != nil || attempt >= t.MaxRetries {
+			return resp, nil
+		}
+
+		if d, ok := retryAfter(resp.Header, time.Now()); ok {
+			backoff = d
+		}
+
+		// nolint: errcheck
+		resp.Body.Close()
+
+		log.Printf("registry rate limited request to %s, retrying in %s", req.URL, backoff)
+
+		t.holdFor(backoff)
+	}
+}
+
+func (t *RateLimitTransport) backoff(attempt int) time.Duration {
+	d := t.BaseBackoff << uint(attempt)
+	if d <= 0 || d > t.MaxBackoff {
+		d = t.MaxBackoff
+	}
+
+	return d
+}
+
+func (t *RateLimitTransport) holdFor(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if until := time.Now().Add(d); until.After(t.until) {
+		t.until = until
+	}
+}
+
+// wait blocks until requests are no longer held back, or the context is
+// done.
+func (t *RateLimitTransport) wait(ctx context.Context) error {
+	t.mu.Lock()
+	d := time.Until(t.until)
+	t.mu.Unlock()
+
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// retryAfter parses the Retry-After header, which is either a number of
+// seconds or an HTTP date.
+func retryAfter(h http.Header, now time.Time) (time.Duration, bool) {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(v); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		return t.Sub(now), true
+	}
+
+	return 0, false
+}
+
+// rateLimitRemaining parses the RateLimit-Remaining header (e.g. "100;w=21600").
+func rateLimitRemaining(h http.Header) (int, bool) {
+	v := h.Get("RateLimit-Remaining")
+	if v == "" {
+		return 0, false
+	}
+
+	if i := strings.Index(v, ";"); i >= 0 {
+		v = v[:i]
+	}
+
+	remaining, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil {
+		return 0, false
+	}
+
+	return remaining, true
+}
+
+// rateLimitReset returns the time until the quota resets. It is the number of
+// seconds in the RateLimit-Reset header, or else the window of the
+// RateLimit-Limit header (e.g. "100;w=21600").
+func rateLimitReset(h http.Header) (time.Duration, bool) {
+	if v := h.Get("RateLimit-Reset"); v != "" {
+		if seconds, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+
+	params := strings.Split(h.Get("RateLimit-Limit"), ";")
+
+	for _, param := range params[1:] {
+		param = strings.TrimSpace(param)
+
+		if !strings.HasPrefix(param, "w=") {
+			continue
+		}
+
+		if seconds, err := strconv.Atoi(strings.TrimPrefix(param, "w=")); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+
+	return 0, false
+}
+
+type cachedResponse struct {
+	etag   string
+	header http.Header
+	body   []byte
+}
+
+// ConditionalTransport makes GET requests for manifests and tag lists
+// conditional by sending the ETag of the last response for the same URL. A
+// 304 Not Modified response is replaced by the cached response so that callers
+// are unaware of the cache. The least recently used responses are evicted.
+type ConditionalTransport struct {
+	Transport http.RoundTripper
+
+	responses *lru.Cache
+}
+
+func NewConditionalTransport(rt http.RoundTripper) (*ConditionalTransport, error) {
+	responses, err := lru.New(DefaultMaxCachedResponses)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ConditionalTransport{
+		Transport: rt,
+		responses: responses,
+	}, nil
+}
+
+// cacheable returns true for the requests of manifests and tag lists. Blobs
+// are content addressable and too large to keep in memory.
+func cacheable(req *http.Request) bool {
+	if req.Method != http.MethodGet {
+		return false
+	}
+
+	return strings.HasSuffix(req.URL.Path, "/tags/list") || strings.Contains(req.URL.Path, "/manifests/")
+}
+
+func (t *ConditionalTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !cacheable(req) {
+		return t.Transport.RoundTrip(req)
+	}
+
+	key := req.URL.String()
+
+	var cached cachedResponse
+
+	v, ok := t.responses.Get(key)
+	if ok {
+		cached = v.(cachedResponse)
+
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+
+	resp, err := t.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case ok && resp.StatusCode == http.StatusNotModified:
+		// nolint: errcheck
+		resp.Body.Close()
+
+		resp.StatusCode = http.StatusOK
+		resp.Status = http.StatusText(http.StatusOK)
+		resp.Header = cached.header.Clone()
+		resp.ContentLength = int64(len(cached.body))
+		resp.Body = ioutil.NopCloser(bytes.NewReader(cached.body))
+
+		return resp, nil
+	case resp.StatusCode == http.StatusOK && resp.Header.Get("ETag") != "":
+		body, err := ioutil.ReadAll(resp.Body)
+		// nolint: errcheck
+		resp.Body.Close()
+
+		if err != nil {
+			return nil, err
+		}
+
+		t.responses.Add(key, cachedResponse{
+			etag:   resp.Header.Get("ETag"),
+			header: resp.Header.Clone(),
+			body:   body,
+		})
+
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		return resp, nil
+	}
+
+	return resp, nil
+}
+
+// MetricsTransport records the latency and errors of the requests to the
+// registry, labelled by the registry's host. Responses with a server error
+// are counted as errors.
+type MetricsTransport struct {
+	Transport http.RoundTripper
+}
+
+func NewMetricsTransport(rt http.RoundTripper) *MetricsTransport {
+	return &MetricsTransport{Transport: rt}
+}
+
+func (t *MetricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+
+	resp, err := t.Transport.RoundTrip(req)
+
+	metrics.RegistryRequestDuration.WithLabelValues(req.URL.Host).Observe(time.Since(start).Seconds())
+
+	if err != nil || resp.StatusCode >= http.StatusInternalServerError {
+		metrics.RegistryRequestErrors.WithLabelValues(req.URL.Host).Inc()
+	}
+
+	return resp, err
+}
@@ -0,0 +1,233 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package registry
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/talos-systems/talos-controller-manager/pkg/metrics"
+)
+
+func TestRateLimitTransport(t *testing.T) {
+	var requests int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		if requests < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	rt := NewRateLimitTransport(http.DefaultTransport)
+	rt.BaseBackoff = time.Millisecond
+
+	resp, err := (&http.Client{Transport: rt}).Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// nolint: errcheck
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("StatusCode = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	if requests != 3 {
+		t.Errorf("requests = %d, want %d", requests, 3)
+	}
+}
+
+func TestRateLimitTransportContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("RateLimit-Limit", "100;w=21600")
+		w.Header().Set("RateLimit-Remaining", "0;w=21600")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	c := &http.Client{Transport: NewRateLimitTransport(http.DefaultTransport)}
+
+	resp, err := c.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nolint: errcheck
+	resp.Body.Close()
+
+	// The quota is spent for the rest of the window, so the next request is
+	// held back until it is cancelled.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = c.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Do() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestConditionalTransport(t *testing.T) {
+	var fetches int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+
+			return
+		}
+
+		fetches++
+
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("tags")) // nolint: errcheck
+	}))
+	defer server.Close()
+
+	rt, err := NewConditionalTransport(http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &http.Client{Transport: rt}
+
+	for i := 0; i < 2; i++ {
+		resp, err := c.Get(server.URL + "/v2/autonomy/installer/tags/list")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := ioutil.ReadAll(resp.Body)
+		// nolint: errcheck
+		resp.Body.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != "tags" {
+			t.Errorf("body = %q, want %q", string(b), "tags")
+		}
+	}
+
+	if fetches != 1 {
+		t.Errorf("fetches = %d, want %d", fetches, 1)
+	}
+
+	// Blobs are not cached.
+	for i := 0; i < 2; i++ {
+		resp, err := c.Get(server.URL + "/v2/autonomy/installer/blobs/sha256:4ee6ee1e")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// nolint: errcheck
+		resp.Body.Close()
+	}
+
+	if fetches != 3 {
+		t.Errorf("fetches = %d, want %d", fetches, 3)
+	}
+}
+
+func TestRateLimitReset(t *testing.T) {
+	tests := []struct {
+		name   string
+		reset  string
+		limit  string
+		want   time.Duration
+		wantOk bool
+	}{
+		{name: "reset", reset: "60", limit: "100;w=21600", want: time.Minute, wantOk: true},
+		{name: "window", limit: "100;w=21600", want: 6 * time.Hour, wantOk: true},
+		{name: "no window", limit: "100", wantOk: false},
+		{name: "missing", wantOk: false},
+		{name: "invalid", reset: "soon", limit: "100;w=later", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			h.Set("RateLimit-Reset", tt.reset)
+			h.Set("RateLimit-Limit", tt.limit)
+
+			got, ok := rateLimitReset(h)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("rateLimitReset() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Duration
+		wantOk bool
+	}{
+		{name: "seconds", value: "120", want: 2 * time.Minute, wantOk: true},
+		{name: "http date", value: "Wed, 01 Jan 2020 00:00:30 GMT", want: 30 * time.Second, wantOk: true},
+		{name: "missing", value: "", wantOk: false},
+		{name: "invalid", value: "soon", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			h.Set("Retry-After", tt.value)
+
+			got, ok := retryAfter(h, now)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("retryAfter() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestMetricsTransport(t *testing.T) {
+	var status int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewMetricsTransport(http.DefaultTransport)}
+
+	host := server.Listener.Addr().String()
+
+	for _, status = range []int{http.StatusOK, http.StatusNotFound, http.StatusBadGateway} {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// nolint: errcheck
+		resp.Body.Close()
+	}
+
+	if errors := testutil.ToFloat64(metrics.RegistryRequestErrors.WithLabelValues(host)); errors != 1 {
+		t.Errorf("errors = %v, want 1", errors)
+	}
+}
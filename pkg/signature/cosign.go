@@ -0,0 +1,240 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package signature
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	digest "github.com/opencontainers/go-digest"
+
+	"github.com/talos-systems/talos-controller-manager/pkg/registry"
+)
+
+const (
+	// CosignSignatureAnnotation holds the base64 encoded signature of the
+	// layer's payload.
+	CosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+	// CosignArtifactType is the artifact type of signatures stored as OCI
+	// referrers.
+	CosignArtifactType = "application/vnd.dev.cosign.artifact.sig.v1+json"
+)
+
+// Cosign verifies cosign signatures stored in the image's registry, either
+// as OCI referrers of the image or under the sha256-<digest>.sig tag.
+type Cosign struct {
+	keys []crypto.PublicKey
+}
+
+// NewCosign returns a verifier trusting the PEM encoded public keys.
+func NewCosign(pems []string) (*Cosign, error) {
+	keys, err := parsePublicKeys(pems)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cosign{keys: keys}, nil
+}
+
+// parsePublicKeys parses the PEM encoded public keys. At least one is
+// required.
+func parsePublicKeys(pems []string) ([]crypto.PublicKey, error) {
+	var keys []crypto.PublicKey
+
+	for _, p := range pems {
+		block, _ := pem.Decode([]byte(p))
+		if block == nil {
+			return nil, errors.New("failed to decode public key PEM")
+		}
+
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("at least one public key is required")
+	}
+
+	return keys, nil
+}
+
+// simpleSigning is the payload signed by cosign.
+type simpleSigning struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+}
+
+func (c *Cosign) Verify(ctx context.Context, image string) error {
+	img, err := registry.ParseImage(image)
+	if err != nil {
+		return err
+	}
+
+	repo, err := registry.New(ctx, img.Registry, img.Repository)
+	if err != nil {
+		return err
+	}
+
+	return c.verifyImage(ctx, repo, image, img.Tag, img.Digest)
+}
+
+func (c *Cosign) verifyImage(ctx context.Context, repo *registry.Repository, image, tag string, dgst digest.Digest) (err error) {
+	if dgst == "" {
+		if dgst, err = repo.Digest(ctx, tag); err != nil {
+			return fmt.Errorf("failed to resolve digest of %q: %w", image, err)
+		}
+	}
+
+	manifests, err := signatures(ctx, repo, dgst)
+	if err != nil {
+		return err
+	}
+
+	if len(manifests) == 0 {
+		return NewUnsignedError(image)
+	}
+
+	reason := "no signatures found"
+
+	for _, m := range manifests {
+		for _, layer := range m.Layers {
+			sig, ok := layer.Annotations[CosignSignatureAnnotation]
+			if !ok {
+				continue
+			}
+
+			payload, err := repo.Blob(ctx, layer.Digest)
+			if err != nil {
+				return err
+			}
+
+			if err = c.verify(payload, sig, dgst); err != nil {
+				reason = err.Error()
+
+				continue
+			}
+
+			return nil
+		}
+	}
+
+	return NewUntrustedError(image, reason)
+}
+
+func (c *Cosign) verify(payload []byte, sig string, dgst digest.Digest) error {
+	var s simpleSigning
+
+	if err := json.Unmarshal(payload, &s); err != nil {
+		return fmt.Errorf("invalid signature payload: %w", err)
+	}
+
+	// The signature must be for this image, and not one that was copied
+	// from another image.
+	if s.Critical.Image.DockerManifestDigest != dgst.String() {
+		return fmt.Errorf("signature is for %q", s.Critical.Image.DockerManifestDigest)
+	}
+
+	b, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+
+	for _, key := range c.keys {
+		if verify(key, payload, b) {
+			return nil
+		}
+	}
+
+	return errors.New("signature does not match any trusted key")
+}
+
+// signatures returns the cosign signature manifests of the digest, preferring
+// OCI referrers and falling back to the tag based scheme.
+func signatures(ctx context.Context, repo *registry.Repository, dgst digest.Digest) ([]*registry.OCIManifest, error) {
+	var manifests []*registry.OCIManifest
+
+	referrers, err := repo.Referrers(ctx, dgst)
+	if err != nil && err != registry.ErrNotFound {
+		return nil, err
+	}
+
+	for _, referrer := range referrers {
+		if referrer.ArtifactType != CosignArtifactType {
+			continue
+		}
+
+		m, err := repo.OCIManifest(ctx, referrer.Digest.String())
+		if err != nil {
+			return nil, err
+		}
+
+		manifests = append(manifests, m)
+	}
+
+	if len(manifests) > 0 {
+		return manifests, nil
+	}
+
+	tag := strings.Replace(dgst.String(), ":", "-", 1) + ".sig"
+
+	m, err := repo.OCIManifest(ctx, tag)
+	if err != nil {
+		if err == registry.ErrNotFound {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return append(manifests, m), nil
+}
+
+func verify(key crypto.PublicKey, payload, sig []byte) bool {
+	h := sha256.Sum256(payload)
+
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		var s struct {
+			R, S *big.Int
+		}
+
+		if _, err := asn1.Unmarshal(sig, &s); err != nil {
+			return false
+		}
+
+		return ecdsa.Verify(k, h[:], s.R, s.S)
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(k, crypto.SHA256, h[:], sig) == nil {
+			return true
+		}
+
+		return rsa.VerifyPSS(k, crypto.SHA256, h[:], sig, nil) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, payload, sig)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,179 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package signature
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+
+	"github.com/talos-systems/talos-controller-manager/pkg/registry"
+)
+
+func newKey(t *testing.T) (*ecdsa.PrivateKey, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: b}))
+}
+
+// newTestRegistry serves an image manifest for each tag, with a cosign
+// signature made with the key (if any) stored under the .sig tag.
+func newTestRegistry(t *testing.T, signers map[string]*ecdsa.PrivateKey) *httptest.Server {
+	manifests := map[string][]byte{}
+	blobs := map[digest.Digest][]byte{}
+
+	for tag, key := range signers {
+		image := []byte(`{"schemaVersion":2,"mediaType":"` + registry.MediaTypeOCIManifest + `","tag":"` + tag + `"}`)
+		dgst := digest.FromBytes(image)
+
+		manifests[tag] = image
+		manifests[dgst.String()] = image
+
+		if key == nil {
+			continue
+		}
+
+		payload := []byte(`{"critical":{"identity":{"docker-reference":"test/installer"},"image":{"docker-manifest-digest":"` + dgst.String() + `"},"type":"cosign container image signature"}}`)
+		h := sha256.Sum256(payload)
+
+		r, s, err := ecdsa.Sign(rand.Reader, key, h[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sig, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		blobs[digest.FromBytes(payload)] = payload
+
+		m, err := json.Marshal(registry.OCIManifest{
+			MediaType: registry.MediaTypeOCIManifest,
+			Layers: []registry.Descriptor{
+				{
+					MediaType:   "application/vnd.dev.cosign.simplesigning.v1+json",
+					Digest:      digest.FromBytes(payload),
+					Size:        int64(len(payload)),
+					Annotations: map[string]string{CosignSignatureAnnotation: base64.StdEncoding.EncodeToString(sig)},
+				},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		manifests[strings.Replace(dgst.String(), ":", "-", 1)+".sig"] = m
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/v2/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Docker-Distribution-Api-Version", "registry/2.0")
+
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v2/test/installer/manifests/"):
+			m, ok := manifests[strings.TrimPrefix(r.URL.Path, "/v2/test/installer/manifests/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+
+				return
+			}
+
+			w.Header().Set("Content-Type", registry.MediaTypeOCIManifest)
+			w.Header().Set("Content-Length", strconv.Itoa(len(m)))
+			w.Header().Set("Docker-Content-Digest", digest.FromBytes(m).String())
+			w.Write(m) // nolint: errcheck
+		case strings.HasPrefix(r.URL.Path, "/v2/test/installer/blobs/"):
+			b, ok := blobs[digest.Digest(strings.TrimPrefix(r.URL.Path, "/v2/test/installer/blobs/"))]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+
+				return
+			}
+
+			w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+			w.Write(b) // nolint: errcheck
+		case r.URL.Path != "/v2/":
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestCosignVerify(t *testing.T) {
+	trusted, trustedPEM := newKey(t)
+	untrusted, _ := newKey(t)
+
+	server := newTestRegistry(t, map[string]*ecdsa.PrivateKey{
+		"trusted":   trusted,
+		"untrusted": untrusted,
+		"unsigned":  nil,
+	})
+	defer server.Close()
+
+	repo, err := registry.New(context.Background(), server.URL, "test/installer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewCosign([]string{trustedPEM})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		tag     string
+		wantErr error
+	}{
+		{tag: "trusted"},
+		{tag: "untrusted", wantErr: UntrustedError{}},
+		{tag: "unsigned", wantErr: UnsignedError{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			err := c.verifyImage(context.Background(), repo, "test/installer:"+tt.tag, tt.tag, "")
+
+			switch tt.wantErr.(type) {
+			case nil:
+				if err != nil {
+					t.Errorf("Verify() error = %v, want nil", err)
+				}
+			case UntrustedError:
+				if _, ok := err.(UntrustedError); !ok {
+					t.Errorf("Verify() error = %v, want UntrustedError", err)
+				}
+			case UnsignedError:
+				if _, ok := err.(UnsignedError); !ok {
+					t.Errorf("Verify() error = %v, want UnsignedError", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package signature
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	_ "crypto/sha256" // SHA-256 is used by PS256 and ES256.
+	_ "crypto/sha512" // SHA-384 and SHA-512 are used by PS384, PS512, ES384 and ES512.
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	digest "github.com/opencontainers/go-digest"
+
+	"github.com/talos-systems/talos-controller-manager/pkg/registry"
+)
+
+const (
+	// NotationArtifactType is the artifact type of notation signatures,
+	// which are stored as OCI referrers.
+	NotationArtifactType = "application/vnd.cncf.notary.signature"
+
+	// NotationJWSMediaType is the media type of JWS signature envelopes.
+	NotationJWSMediaType = "application/jose+json"
+
+	// NotationPayloadContentType is the content type of the signed payload.
+	NotationPayloadContentType = "application/vnd.cncf.notary.payload.v1+json"
+)
+
+// Notation verifies notation signatures stored as OCI referrers of the
+// image. A signature is trusted when it verifies against the certificate it
+// was made with, and that certificate's public key is a trusted key. Only JWS
+// signature envelopes are supported.
+type Notation struct {
+	keys []crypto.PublicKey
+}
+
+// NewNotation returns a verifier trusting the PEM encoded public keys.
+func NewNotation(pems []string) (*Notation, error) {
+	keys, err := parsePublicKeys(pems)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Notation{keys: keys}, nil
+}
+
+// jwsEnvelope is a JWS signature envelope in the flattened JSON
+// serialization.
+type jwsEnvelope struct {
+	Payload   string `json:"payload"`
+	Protected string `json:"protected"`
+	Header    struct {
+		// X5C is the certificate chain, starting with the signing
+		// certificate.
+		X5C [][]byte `json:"x5c"`
+	} `json:"header"`
+	Signature string `json:"signature"`
+}
+
+// jwsHeader is the protected header of the envelope.
+type jwsHeader struct {
+	Alg string `json:"alg"`
+	Cty string `json:"cty"`
+}
+
+// notationPayload is the payload signed by notation.
+type notationPayload struct {
+	TargetArtifact struct {
+		Digest string `json:"digest"`
+	} `json:"targetArtifact"`
+}
+
+func (n *Notation) Verify(ctx context.Context, image string) error {
+	img, err := registry.ParseImage(image)
+	if err != nil {
+		return err
+	}
+
+	repo, err := registry.New(ctx, img.Registry, img.Repository)
+	if err != nil {
+		return err
+	}
+
+	return n.verifyImage(ctx, repo, image, img.Tag, img.Digest)
+}
+
+func (n *Notation) verifyImage(ctx context.Context, repo *registry.Repository, image, tag string, dgst digest.Digest) (err error) {
+	if dgst == "" {
+		if dgst, err = repo.Digest(ctx, tag); err != nil {
+			return fmt.Errorf("failed to resolve digest of %q: %w", image, err)
+		}
+	}
+
+	referrers, err := repo.Referrers(ctx, dgst)
+	if err != nil && err != registry.ErrNotFound {
+		return err
+	}
+
+	signed := false
+	reason := "no signatures found"
+
+	for _, referrer := range referrers {
+		if referrer.ArtifactType != NotationArtifactType {
+			continue
+		}
+
+		signed = true
+
+		m, err := repo.OCIManifest(ctx, referrer.Digest.String())
+		if err != nil {
+			return err
+		}
+
+		for _, layer := range m.Layers {
+			if layer.MediaType != NotationJWSMediaType {
+				reason = fmt.Sprintf("unsupported signature envelope %q", layer.MediaType)
+
+				continue
+			}
+
+			envelope, err := repo.Blob(ctx, layer.Digest)
+			if err != nil {
+				return err
+			}
+
+			if err = n.verify(envelope, dgst); err != nil {
+				reason = err.Error()
+
+				continue
+			}
+
+			return nil
+		}
+	}
+
+	if !signed {
+		return NewUnsignedError(image)
+	}
+
+	return NewUntrustedError(image, reason)
+}
+
+func (n *Notation) verify(b []byte, dgst digest.Digest) error {
+	var envelope jwsEnvelope
+
+	if err := json.Unmarshal(b, &envelope); err != nil {
+		return fmt.Errorf("invalid signature envelope: %w", err)
+	}
+
+	protected, err := base64.RawURLEncoding.DecodeString(envelope.Protected)
+	if err != nil {
+		return fmt.Errorf("invalid protected header encoding: %w", err)
+	}
+
+	var header jwsHeader
+
+	if err = json.Unmarshal(protected, &header); err != nil {
+		return fmt.Errorf("invalid protected header: %w", err)
+	}
+
+	if header.Cty != NotationPayloadContentType {
+		return fmt.Errorf("unexpected payload content type %q", header.Cty)
+	}
+
+	if len(envelope.Header.X5C) == 0 {
+		return errors.New("signature has no certificate")
+	}
+
+	cert, err := x509.ParseCertificate(envelope.Header.X5C[0])
+	if err != nil {
+		return fmt.Errorf("invalid signing certificate: %w", err)
+	}
+
+	if !n.trusted(cert.PublicKey) {
+		return errors.New("signing certificate's key is not trusted")
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(envelope.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+
+	if err = verifyJWS(cert.PublicKey, header.Alg, []byte(envelope.Protected+"."+envelope.Payload), sig); err != nil {
+		return err
+	}
+
+	b, err = base64.RawURLEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		return fmt.Errorf("invalid payload encoding: %w", err)
+	}
+
+	var payload notationPayload
+
+	if err = json.Unmarshal(b, &payload); err != nil {
+		return fmt.Errorf("invalid signature payload: %w", err)
+	}
+
+	// The signature must be for this image, and not one that was copied
+	// from another image.
+	if payload.TargetArtifact.Digest != dgst.String() {
+		return fmt.Errorf("signature is for %q", payload.TargetArtifact.Digest)
+	}
+
+	return nil
+}
+
+// trusted returns true if the key is one of the trusted keys.
+func (n *Notation) trusted(key crypto.PublicKey) bool {
+	k, ok := key.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return false
+	}
+
+	for _, trusted := range n.keys {
+		if k.Equal(trusted) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// verifyJWS verifies the JWS signature of the signing input with the
+// algorithms allowed by notation.
+func verifyJWS(key crypto.PublicKey, alg string, input, sig []byte) error {
+	var hash crypto.Hash
+
+	switch alg {
+	case "PS256", "ES256":
+		hash = crypto.SHA256
+	case "PS384", "ES384":
+		hash = crypto.SHA384
+	case "PS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported signature algorithm %q", alg)
+	}
+
+	h := hash.New()
+	h.Write(input) // nolint: errcheck
+
+	sum := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if alg[0] != 'P' {
+			return fmt.Errorf("signature algorithm %q does not match the RSA key", alg)
+		}
+
+		if err := rsa.VerifyPSS(k, hash, sum, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}); err != nil {
+			return errors.New("signature does not match the signing certificate")
+		}
+
+		return nil
+	case *ecdsa.PublicKey:
+		if alg[0] != 'E' {
+			return fmt.Errorf("signature algorithm %q does not match the ECDSA key", alg)
+		}
+
+		// JWS ECDSA signatures are the concatenated R and S values.
+		if len(sig) == 0 || len(sig)%2 != 0 {
+			return errors.New("invalid ECDSA signature length")
+		}
+
+		r := new(big.Int).SetBytes(sig[:len(sig)/2])
+		s := new(big.Int).SetBytes(sig[len(sig)/2:])
+
+		if !ecdsa.Verify(k, sum, r, s) {
+			return errors.New("signature does not match the signing certificate")
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unsupported signing key %T", key)
+	}
+}
@@ -0,0 +1,217 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package signature
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+
+	"github.com/talos-systems/talos-controller-manager/pkg/registry"
+)
+
+// newEnvelope returns a notation JWS envelope signing the digest with the
+// key, and a self-signed certificate for it.
+func newEnvelope(t *testing.T, key *ecdsa.PrivateKey, dgst digest.Digest) []byte {
+	cert, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}, &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "test"}}, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	protected := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256","cty":"` + NotationPayloadContentType + `"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"targetArtifact":{"mediaType":"` + registry.MediaTypeOCIManifest + `","digest":"` + dgst.String() + `"}}`))
+
+	h := sha256.Sum256([]byte(protected + "." + payload))
+
+	r, s, err := ecdsa.Sign(rand.Reader, key, h[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+
+	envelope := jwsEnvelope{
+		Payload:   payload,
+		Protected: protected,
+		Signature: base64.RawURLEncoding.EncodeToString(sig),
+	}
+	envelope.Header.X5C = [][]byte{cert}
+
+	b, err := json.Marshal(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+// newNotationRegistry serves an image manifest for each tag, with a notation
+// signature made with the key (if any) listed as its referrer.
+func newNotationRegistry(t *testing.T, signers map[string]*ecdsa.PrivateKey) *httptest.Server {
+	manifests := map[string][]byte{}
+	referrers := map[string][]byte{}
+	blobs := map[digest.Digest][]byte{}
+
+	for tag, key := range signers {
+		image := []byte(`{"schemaVersion":2,"mediaType":"` + registry.MediaTypeOCIManifest + `","tag":"` + tag + `"}`)
+		dgst := digest.FromBytes(image)
+
+		manifests[tag] = image
+		manifests[dgst.String()] = image
+
+		var index registry.OCIManifest
+
+		index.MediaType = registry.MediaTypeOCIIndex
+
+		if key != nil {
+			envelope := newEnvelope(t, key, dgst)
+			blobs[digest.FromBytes(envelope)] = envelope
+
+			m, err := json.Marshal(registry.OCIManifest{
+				MediaType:    registry.MediaTypeOCIManifest,
+				ArtifactType: NotationArtifactType,
+				Layers: []registry.Descriptor{
+					{
+						MediaType: NotationJWSMediaType,
+						Digest:    digest.FromBytes(envelope),
+						Size:      int64(len(envelope)),
+					},
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			manifests[digest.FromBytes(m).String()] = m
+
+			index.Manifests = append(index.Manifests, registry.Descriptor{
+				MediaType:    registry.MediaTypeOCIManifest,
+				ArtifactType: NotationArtifactType,
+				Digest:       digest.FromBytes(m),
+				Size:         int64(len(m)),
+			})
+		}
+
+		b, err := json.Marshal(index)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		referrers[dgst.String()] = b
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/v2/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Docker-Distribution-Api-Version", "registry/2.0")
+
+		serve := func(contents map[string][]byte, prefix, mediaType string) {
+			m, ok := contents[strings.TrimPrefix(r.URL.Path, prefix)]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+
+				return
+			}
+
+			w.Header().Set("Content-Type", mediaType)
+			w.Header().Set("Content-Length", strconv.Itoa(len(m)))
+			w.Header().Set("Docker-Content-Digest", digest.FromBytes(m).String())
+			w.Write(m) // nolint: errcheck
+		}
+
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v2/test/installer/manifests/"):
+			serve(manifests, "/v2/test/installer/manifests/", registry.MediaTypeOCIManifest)
+		case strings.HasPrefix(r.URL.Path, "/v2/test/installer/referrers/"):
+			serve(referrers, "/v2/test/installer/referrers/", registry.MediaTypeOCIIndex)
+		case strings.HasPrefix(r.URL.Path, "/v2/test/installer/blobs/"):
+			b, ok := blobs[digest.Digest(strings.TrimPrefix(r.URL.Path, "/v2/test/installer/blobs/"))]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+
+				return
+			}
+
+			w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+			w.Write(b) // nolint: errcheck
+		case r.URL.Path != "/v2/":
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestNotationVerify(t *testing.T) {
+	trusted, trustedPEM := newKey(t)
+	untrusted, _ := newKey(t)
+
+	server := newNotationRegistry(t, map[string]*ecdsa.PrivateKey{
+		"trusted":   trusted,
+		"untrusted": untrusted,
+		"unsigned":  nil,
+	})
+	defer server.Close()
+
+	repo, err := registry.New(context.Background(), server.URL, "test/installer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := NewNotation([]string{trustedPEM})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		tag     string
+		wantErr error
+	}{
+		{tag: "trusted"},
+		{tag: "untrusted", wantErr: UntrustedError{}},
+		{tag: "unsigned", wantErr: UnsignedError{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			err := n.verifyImage(context.Background(), repo, "test/installer:"+tt.tag, tt.tag, "")
+
+			switch tt.wantErr.(type) {
+			case nil:
+				if err != nil {
+					t.Errorf("Verify() error = %v, want nil", err)
+				}
+			case UntrustedError:
+				if _, ok := err.(UntrustedError); !ok {
+					t.Errorf("Verify() error = %v, want UntrustedError", err)
+				}
+			case UnsignedError:
+				if _, ok := err.(UnsignedError); !ok {
+					t.Errorf("Verify() error = %v, want UnsignedError", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package signature
+
+import (
+	"context"
+	"fmt"
+)
+
+// Verifier verifies that an image is signed by a trusted key.
+type Verifier interface {
+	Verify(context.Context, string) error
+}
+
+// UnsignedError is returned when no signature exists for an image.
+type UnsignedError struct {
+	image string
+}
+
+func NewUnsignedError(image string) UnsignedError {
+	return UnsignedError{image}
+}
+
+func (u UnsignedError) Error() string {
+	return fmt.Sprintf("image is not signed: %s", u.image)
+}
+
+// UntrustedError is returned when an image is signed, but none of its
+// signatures verify against a trusted key.
+type UntrustedError struct {
+	image  string
+	reason string
+}
+
+func NewUntrustedError(image, reason string) UntrustedError {
+	return UntrustedError{image, reason}
+}
+
+func (u UntrustedError) Error() string {
+	return fmt.Sprintf("image has no valid signature from a trusted key: %s: %s", u.image, u.reason)
+}
@@ -0,0 +1,55 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package status
+
+import (
+	"html/template"
+	"time"
+)
+
+type dashboardData struct {
+	Pools     []PoolStatus
+	Generated time.Time
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="30">
+<title>Talos Pools</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+th { background: #eee; }
+.Failed { color: #b00; }
+.Succeeded { color: #070; }
+.errors { color: #b00; }
+</style>
+</head>
+<body>
+<h1>Talos Pools</h1>
+<p>Generated at {{ .Generated.Format "2006-01-02 15:04:05 MST" }}. <a href="/api/v1alpha1/pools">JSON</a></p>
+{{ range .Pools }}
+<h2>{{ .Name }}</h2>
+<p>Version <b>{{ .Version }}</b>{{ if .Channel }} from the {{ .Channel }} channel{{ end }}, {{ .Size }} node(s){{ if .InProgress }}, upgrading {{ range $i, $n := .InProgress }}{{ if $i }}, {{ end }}{{ $n }}{{ end }}{{ end }}.{{ if .NextRun }} Next run at {{ .NextRun.Format "2006-01-02 15:04:05 MST" }}.{{ end }}</p>
+{{ if .Errors }}<ul class="errors">{{ range .Errors }}<li>{{ . }}</li>{{ end }}</ul>{{ end }}
+{{ if .Channels }}
+<table>
+<tr><th>Channel</th><th>Version</th><th>Source</th><th>Discovered</th></tr>
+{{ range $c, $e := .Channels }}<tr><td>{{ $c }}</td><td>{{ $e.Version }}</td><td>{{ $e.Source }}</td><td>{{ if not $e.Discovered.IsZero }}{{ $e.Discovered.Format "2006-01-02 15:04:05 MST" }}{{ end }}</td></tr>
+{{ end }}</table>
+{{ end }}
+<table>
+<tr><th>Node</th><th>Phase</th><th>Version</th><th>Target Version</th><th>Since</th><th>Message</th></tr>
+{{ range .Nodes }}<tr><td>{{ .Name }}</td><td class="{{ .Phase }}">{{ .Phase }}{{ if .Reason }} ({{ .Reason }}){{ end }}</td><td>{{ .Version }}</td><td>{{ .TargetVersion }}</td><td>{{ if not .LastTransitionTime.IsZero }}{{ .LastTransitionTime.Format "2006-01-02 15:04:05 MST" }}{{ end }}</td><td>{{ .Message }}</td></tr>
+{{ end }}</table>
+{{ else }}
+<p>No pools.</p>
+{{ end }}
+</body>
+</html>
+`))
@@ -0,0 +1,162 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// PoolsPath lists the status of every pool.
+	PoolsPath = "/api/v1alpha1/pools"
+
+	shutdownTimeout = 5 * time.Second
+)
+
+// Server serves the status of the pools, read with the client, on Addr. It
+// only answers GET and HEAD requests.
+type Server struct {
+	Client    client.Client
+	Namespace string
+	Addr      string
+
+	log logr.Logger
+}
+
+// NewServer returns a server of the pools' status on the address. The
+// channel versions are read from the namespace.
+func NewServer(c client.Client, namespace, addr string) *Server {
+	return &Server{
+		Client:    c,
+		Namespace: namespace,
+		Addr:      addr,
+		log:       ctrl.Log.WithName("status"),
+	}
+}
+
+// Handler returns the handler of the JSON API and the dashboard.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(PoolsPath, s.pools)
+	mux.HandleFunc(PoolsPath+"/", s.pool)
+	mux.HandleFunc("/", s.dashboard)
+
+	return readOnly(mux)
+}
+
+// Start serves until the stop channel is closed. It does not depend on the
+// manager, so that it can run whether or not the controller is the leader.
+func (s *Server) Start(stop <-chan struct{}) error {
+	server := &http.Server{Addr: s.Addr, Handler: s.Handler()}
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		s.log.Info("serving pool status", "addr", s.Addr)
+
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			errCh <- err
+		}
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-stop:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	return server.Shutdown(ctx)
+}
+
+func (s *Server) pools(w http.ResponseWriter, r *http.Request) {
+	pools, err := Pools(r.Context(), s.Client, s.Namespace)
+	if err != nil {
+		s.error(w, err)
+
+		return
+	}
+
+	writeJSON(w, pools)
+}
+
+func (s *Server) pool(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, PoolsPath+"/")
+
+	pools, err := Pools(r.Context(), s.Client, s.Namespace)
+	if err != nil {
+		s.error(w, err)
+
+		return
+	}
+
+	for _, pool := range pools {
+		if pool.Name == name {
+			writeJSON(w, pool)
+
+			return
+		}
+	}
+
+	http.NotFound(w, r)
+}
+
+func (s *Server) dashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	pools, err := Pools(r.Context(), s.Client, s.Namespace)
+	if err != nil {
+		s.error(w, err)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if err = dashboardTemplate.Execute(w, dashboardData{Pools: pools, Generated: time.Now().UTC()}); err != nil {
+		s.log.Error(err, "failed to render dashboard")
+	}
+}
+
+func (s *Server) error(w http.ResponseWriter, err error) {
+	s.log.Error(err, "failed to get pool status")
+
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// nolint: errcheck
+	json.NewEncoder(w).Encode(v)
+}
+
+// readOnly refuses requests other than GET and HEAD.
+func readOnly(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,154 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package status
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
+)
+
+func newScheme(t *testing.T) *runtime.Scheme {
+	scheme := runtime.NewScheme()
+
+	for _, add := range []func(*runtime.Scheme) error{clientgoscheme.AddToScheme, poolv1alpha1.AddToScheme} {
+		if err := add(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return scheme
+}
+
+// forbiddenClient is not allowed to read the versions ConfigMaps.
+type forbiddenClient struct {
+	client.Client
+}
+
+func (c forbiddenClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	if _, ok := obj.(*corev1.ConfigMap); ok {
+		return errors.New("configmaps is forbidden")
+	}
+
+	return c.Client.Get(ctx, key, obj)
+}
+
+func TestPools(t *testing.T) {
+	scheme := newScheme(t)
+
+	workers := &poolv1alpha1.Pool{ObjectMeta: metav1.ObjectMeta{Name: "workers"}}
+	masters := &poolv1alpha1.Pool{ObjectMeta: metav1.ObjectMeta{Name: "masters"}}
+
+	c := forbiddenClient{fake.NewFakeClientWithScheme(scheme, workers, masters)}
+
+	pools, err := Pools(context.Background(), c, "talos-system")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pools) != 2 {
+		t.Fatalf("Pools() returned %d pools, want 2", len(pools))
+	}
+
+	for _, pool := range pools {
+		if len(pool.Errors) != 1 || !strings.Contains(pool.Errors[0], "configmaps is forbidden") {
+			t.Errorf("pool %q errors = %q, want the versions error", pool.Name, pool.Errors)
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	scheme := newScheme(t)
+
+	pool := &poolv1alpha1.Pool{ObjectMeta: metav1.ObjectMeta{Name: "workers"}}
+	pool.Spec.Channel = "stable"
+	pool.Status = poolv1alpha1.PoolStatus{
+		Size:       2,
+		Version:    "v0.4.0",
+		InProgress: "worker-1",
+		Nodes: []poolv1alpha1.NodeStatus{
+			{Name: "worker-1", Phase: poolv1alpha1.NodeVerifying, Version: "v0.4.0", TargetVersion: "v0.4.0"},
+			{Name: "worker-2", Phase: poolv1alpha1.NodeFailed, Version: "v0.3.2", TargetVersion: "v0.4.0", Message: "timeout waiting for node to reboot"},
+		},
+	}
+
+	versions := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "workers-versions", Namespace: "talos-system"},
+		Data:       map[string]string{"stable": `{"version":"v0.4.0","source":"registry"}`},
+	}
+
+	handler := NewServer(fake.NewFakeClientWithScheme(scheme, pool, versions), "talos-system", "").Handler()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+		want   []string
+	}{
+		{
+			name:   "pools",
+			method: http.MethodGet,
+			path:   PoolsPath,
+			status: http.StatusOK,
+			want:   []string{`"name":"workers"`, `"stable":{"version":"v0.4.0"`, `"inProgress":["worker-1"]`, `"errors":["worker-2: timeout waiting for node to reboot"]`},
+		},
+		{
+			name:   "pool",
+			method: http.MethodGet,
+			path:   PoolsPath + "/workers",
+			status: http.StatusOK,
+			want:   []string{`"name":"workers"`, `"targetVersion":"v0.4.0"`},
+		},
+		{
+			name:   "missing pool",
+			method: http.MethodGet,
+			path:   PoolsPath + "/masters",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "dashboard",
+			method: http.MethodGet,
+			path:   "/",
+			status: http.StatusOK,
+			want:   []string{"<h2>workers</h2>", "worker-2", "timeout waiting for node to reboot"},
+		},
+		{
+			name:   "read only",
+			method: http.MethodPost,
+			path:   PoolsPath,
+			status: http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(w.Body.String(), want) {
+					t.Errorf("body does not contain %s:\n%s", want, w.Body.String())
+				}
+			}
+		})
+	}
+}
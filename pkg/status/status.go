@@ -0,0 +1,108 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package status serves a read-only view of the pools, as JSON and as an
+// HTML dashboard.
+package status
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
+	"github.com/talos-systems/talos-controller-manager/pkg/channel"
+	"github.com/talos-systems/talos-controller-manager/pkg/version"
+)
+
+// PoolStatus is the status of a pool, its resolved channel versions and its
+// nodes.
+type PoolStatus struct {
+	Name       string                            `json:"name"`
+	Channel    string                            `json:"channel,omitempty"`
+	Version    string                            `json:"version,omitempty"`
+	Image      string                            `json:"image,omitempty"`
+	Digest     string                            `json:"digest,omitempty"`
+	Size       int                               `json:"size"`
+	InProgress []string                          `json:"inProgress,omitempty"`
+	NextRun    *time.Time                        `json:"nextRun,omitempty"`
+	Channels   map[channel.Channel]version.Entry `json:"channels,omitempty"`
+	Nodes      []poolv1alpha1.NodeStatus         `json:"nodes,omitempty"`
+	// Errors are the pool's message, the messages of its failed nodes, and
+	// the failure to read its channel versions.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Pools returns the status of every pool, sorted by name. The channel
+// versions are read from the ConfigMaps persisting them in the namespace; a
+// pool whose versions can not be read is listed with the error.
+func Pools(ctx context.Context, c client.Client, namespace string) ([]PoolStatus, error) {
+	var pools poolv1alpha1.PoolList
+
+	if err := c.List(ctx, &pools); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]PoolStatus, 0, len(pools.Items))
+
+	for i := range pools.Items {
+		pool := &pools.Items[i]
+
+		persisted := version.NewConfigMap(c, namespace, version.ConfigMapName(pool.Name))
+
+		loadErr := persisted.Load(ctx)
+
+		s := NewPoolStatus(pool, persisted.Entries())
+
+		if loadErr != nil {
+			s.Errors = append(s.Errors, fmt.Sprintf("failed to load versions: %v", loadErr))
+		}
+
+		statuses = append(statuses, s)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+
+	return statuses, nil
+}
+
+// NewPoolStatus returns the status of the pool, with its resolved channel
+// versions.
+func NewPoolStatus(pool *poolv1alpha1.Pool, channels map[channel.Channel]version.Entry) PoolStatus {
+	s := PoolStatus{
+		Name:     pool.Name,
+		Channel:  pool.Spec.Channel,
+		Version:  pool.Status.Version,
+		Image:    pool.Status.Image,
+		Digest:   pool.Status.Digest,
+		Size:     pool.Status.Size,
+		Channels: channels,
+		Nodes:    pool.Status.Nodes,
+	}
+
+	if pool.Status.InProgress != "" {
+		s.InProgress = strings.Split(pool.Status.InProgress, ",")
+	}
+
+	if !pool.Status.NextRun.IsZero() {
+		t := pool.Status.NextRun.Time
+		s.NextRun = &t
+	}
+
+	if pool.Status.Message != "" {
+		s.Errors = append(s.Errors, pool.Status.Message)
+	}
+
+	for _, n := range pool.Status.Nodes {
+		if n.Phase == poolv1alpha1.NodeFailed {
+			s.Errors = append(s.Errors, fmt.Sprintf("%s: %s", n.Name, n.Message))
+		}
+	}
+
+	return s
+}
@@ -0,0 +1,104 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package tracing sets up the OpenTelemetry tracing of the controller. Spans
+// are exported over OTLP when an endpoint is configured, and are otherwise
+// discarded.
+package tracing
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+)
+
+const (
+	// EndpointEnvVar is the OTLP endpoint spans are exported to. The other
+	// OTEL_EXPORTER_OTLP_* env vars, such as OTEL_EXPORTER_OTLP_INSECURE,
+	// configure the exporter.
+	EndpointEnvVar = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	// TracesEndpointEnvVar is the OTLP endpoint of traces, and takes
+	// precedence over EndpointEnvVar.
+	TracesEndpointEnvVar = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+
+	// ServiceName is the name of the service spans are recorded for.
+	ServiceName = "talos-controller-manager"
+
+	instrumentationName = "github.com/talos-systems/talos-controller-manager"
+)
+
+// The attributes of the spans.
+const (
+	PoolKey          = attribute.Key("talos.pool")
+	NodeKey          = attribute.Key("talos.node")
+	PhaseKey         = attribute.Key("talos.phase")
+	VersionKey       = attribute.Key("talos.version")
+	TargetVersionKey = attribute.Key("talos.target_version")
+	ChannelKey       = attribute.Key("talos.channel")
+)
+
+// Setup exports spans to the OTLP endpoint set by the env vars. Tracing is
+// disabled if no endpoint is set. The returned function flushes the spans and
+// stops the exporter.
+func Setup(ctx context.Context) (func(context.Context) error, error) {
+	if os.Getenv(EndpointEnvVar) == "" && os.Getenv(TracesEndpointEnvVar) == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracegrpc.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(ServiceName))),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return provider.Shutdown, nil
+}
+
+// Start starts a span of the controller.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// StartAt starts a span of the controller that started at t.
+func StartAt(ctx context.Context, name string, t time.Time, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithTimestamp(t), trace.WithAttributes(attrs...))
+}
+
+// End records the error on the span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// DialOptions returns the options of gRPC clients that trace the calls, and
+// propagate the trace context to the server.
+func DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithUnaryInterceptor(otelgrpc.UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(otelgrpc.StreamClientInterceptor()),
+	}
+}
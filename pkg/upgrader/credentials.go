@@ -0,0 +1,331 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upgrader
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	talostls "github.com/talos-systems/crypto/tls"
+	talosx509 "github.com/talos-systems/crypto/x509"
+	"github.com/talos-systems/talos/pkg/machinery/client"
+	"github.com/talos-systems/talos/pkg/machinery/client/config"
+	talosconstants "github.com/talos-systems/talos/pkg/machinery/constants"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	// CredentialsEnvVar is the directory of a mounted Secret holding the
+	// Talos API credentials.
+	CredentialsEnvVar = "TALOS_CREDENTIALS"
+	// ContextEnvVar is the talosconfig context to use, instead of the
+	// talosconfig's current context.
+	ContextEnvVar = "TALOS_CONTEXT"
+	// TokenEnvVar is the token used to request certificates from trustd.
+	TokenEnvVar = "TALOS_TOKEN"
+)
+
+// The keys of a Secret holding the Talos API credentials.
+const (
+	SecretCAKey          = "ca.crt"
+	SecretCertificateKey = corev1.TLSCertKey
+	SecretKeyKey         = corev1.TLSPrivateKeyKey
+)
+
+// CredentialsSource loads the Talos API client's CA and certificate.
+type CredentialsSource interface {
+	Load() (*client.Credentials, error)
+	// ModTime returns when the credentials last changed.
+	ModTime() (time.Time, error)
+}
+
+// TalosconfigSource loads the credentials of a talosconfig's context, or of
+// its current context if none is set.
+type TalosconfigSource struct {
+	Path    string
+	Context string
+}
+
+// Load implements the CredentialsSource interface.
+func (s TalosconfigSource) Load() (*client.Credentials, error) {
+	b, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := config.FromString(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse talosconfig: %w", err)
+	}
+
+	_, creds, err := client.NewClientContextAndCredentialsFromParsedConfig(c, s.Context)
+
+	return creds, err
+}
+
+// ModTime implements the CredentialsSource interface.
+func (s TalosconfigSource) ModTime() (time.Time, error) {
+	info, err := os.Stat(s.Path)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return info.ModTime(), nil
+}
+
+// SecretSource loads the credentials from the directory a Secret is mounted
+// in, with the PEM encoded CA, certificate and key in the ca.crt, tls.crt and
+// tls.key keys.
+type SecretSource struct {
+	Dir string
+}
+
+// Load implements the CredentialsSource interface.
+func (s SecretSource) Load() (*client.Credentials, error) {
+	files := map[string][]byte{SecretCAKey: nil, SecretCertificateKey: nil, SecretKeyKey: nil}
+
+	for key := range files {
+		b, err := ioutil.ReadFile(filepath.Join(s.Dir, key))
+		if err != nil {
+			return nil, err
+		}
+
+		files[key] = b
+	}
+
+	crt, err := tls.X509KeyPair(files[SecretCertificateKey], files[SecretKeyKey])
+	if err != nil {
+		return nil, fmt.Errorf("could not load client key pair: %w", err)
+	}
+
+	return &client.Credentials{CA: files[SecretCAKey], Crt: crt}, nil
+}
+
+// ModTime implements the CredentialsSource interface. It is the latest
+// modification time of the keys, which are followed if they are symlinks as
+// in a mounted Secret.
+func (s SecretSource) ModTime() (time.Time, error) {
+	var latest time.Time
+
+	for _, key := range []string{SecretCAKey, SecretCertificateKey, SecretKeyKey} {
+		info, err := os.Stat(filepath.Join(s.Dir, key))
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+// ReloadingCredentials reloads the credentials from their source when it
+// changes, so that rotated certificates are used by new connections without
+// restarting the controller. The previous credentials are used if the
+// changed credentials fail to load, until the source changes again.
+type ReloadingCredentials struct {
+	log    logr.Logger
+	source CredentialsSource
+
+	mu      sync.Mutex
+	creds   *client.Credentials
+	modTime time.Time
+	statErr bool
+}
+
+// NewReloadingCredentials returns credentials reloaded from the source, which
+// must load successfully at least once.
+func NewReloadingCredentials(source CredentialsSource) (*ReloadingCredentials, error) {
+	modTime, err := source.ModTime()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load credentials: %w", err)
+	}
+
+	creds, err := source.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load credentials: %w", err)
+	}
+
+	c := &ReloadingCredentials{
+		log:     ctrl.Log.WithName("credentials"),
+		source:  source,
+		creds:   creds,
+		modTime: modTime,
+	}
+
+	return c, nil
+}
+
+// Config returns the TLS configuration for connecting to the server.
+func (c *ReloadingCredentials) Config(serverName string) (*tls.Config, error) {
+	cfg, err := talostls.New()
+	if err != nil {
+		return nil, err
+	}
+
+	// The server's certificate is verified against the current CA in
+	// VerifyPeerCertificate instead of the RootCAs loaded once here.
+	cfg.InsecureSkipVerify = true
+	cfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		return verifyPeer(c.current().CA, serverName, rawCerts)
+	}
+
+	cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		crt := c.current().Crt
+
+		return &crt, nil
+	}
+
+	return cfg, nil
+}
+
+// current returns the credentials, reloading them if the source changed
+// since they were last loaded. Failures are logged once per change.
+func (c *ReloadingCredentials) current() *client.Credentials {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	modTime, err := c.source.ModTime()
+	if err != nil {
+		if !c.statErr {
+			c.log.Error(err, "failed to check credentials, using the previous credentials")
+		}
+
+		c.statErr = true
+
+		return c.creds
+	}
+
+	c.statErr = false
+
+	if modTime.Equal(c.modTime) {
+		return c.creds
+	}
+
+	c.modTime = modTime
+
+	creds, err := c.source.Load()
+	if err != nil {
+		c.log.Error(err, "failed to reload credentials, using the previous credentials")
+
+		return c.creds
+	}
+
+	c.log.Info("reloaded credentials")
+
+	c.creds = creds
+
+	return creds
+}
+
+func verifyPeer(ca []byte, serverName string, rawCerts [][]byte) error {
+	// An empty DNSName would skip verifying the certificate's name.
+	if serverName == "" {
+		return errors.New("server name is required to verify the server certificate")
+	}
+
+	if len(rawCerts) == 0 {
+		return errors.New("server presented no certificate")
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca) {
+		return errors.New("failed to parse CA certificate")
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+		DNSName:       serverName,
+	}
+
+	certs := make([]*x509.Certificate, len(rawCerts))
+
+	for i, raw := range rawCerts {
+		crt, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("failed to parse server certificate: %w", err)
+		}
+
+		certs[i] = crt
+
+		if i > 0 {
+			opts.Intermediates.AddCert(crt)
+		}
+	}
+
+	_, err := certs[0].Verify(opts)
+
+	return err
+}
+
+// TLSConfigFunc returns the TLS configuration for connecting to the server.
+type TLSConfigFunc func(serverName string) (*tls.Config, error)
+
+// NewTLSConfigFunc returns the Talos API client's TLS configuration. The
+// credentials are loaded from the talosconfig in TALOSCONFIG, the Secret
+// mounted in TALOS_CREDENTIALS, or requested from trustd on the endpoints
+// with the token in TALOS_TOKEN, in that order.
+func NewTLSConfigFunc(endpoints []string) (TLSConfigFunc, error) {
+	var source CredentialsSource
+
+	if path, ok := os.LookupEnv(talosconstants.TalosConfigEnvVar); ok {
+		source = TalosconfigSource{Path: path, Context: os.Getenv(ContextEnvVar)}
+	} else if dir, ok := os.LookupEnv(CredentialsEnvVar); ok {
+		source = SecretSource{Dir: dir}
+	}
+
+	if source != nil {
+		creds, err := NewReloadingCredentials(source)
+		if err != nil {
+			return nil, err
+		}
+
+		return creds.Config, nil
+	}
+
+	token, ok := os.LookupEnv(TokenEnvVar)
+	if !ok {
+		return nil, fmt.Errorf("one of %s, %s or %s env vars is required", talosconstants.TalosConfigEnvVar, CredentialsEnvVar, TokenEnvVar)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	certificateProvider, err := talostls.NewRenewingCertificateProvider(
+		TrustdGenerator{Token: token, Endpoints: endpoints},
+		talosx509.DNSNames([]string{hostname}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ca, err := certificateProvider.GetCA()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get root CA: %w", err)
+	}
+
+	// The server name is set by the client from its endpoints.
+	return func(string) (*tls.Config, error) {
+		return talostls.New(
+			talostls.WithClientAuthType(talostls.Mutual),
+			talostls.WithCACertPEM(ca),
+			talostls.WithClientCertificateProvider(certificateProvider),
+		)
+	}, nil
+}
@@ -0,0 +1,197 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upgrader
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/talos-systems/talos/pkg/machinery/client"
+)
+
+type testCert struct {
+	crt    *x509.Certificate
+	key    *ecdsa.PrivateKey
+	crtPEM []byte
+	keyPEM []byte
+}
+
+// newCert returns a certificate for the IP signed by the parent, or a self
+// signed CA if the parent is nil.
+func newCert(t *testing.T, parent *testCert, ip string) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: ip},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	signer, signerKey := template, key
+
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		template.IPAddresses = []net.IP{net.ParseIP(ip)}
+		signer, signerKey = parent.crt, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crt, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCert{
+		crt:    crt,
+		key:    key,
+		crtPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: b}),
+	}
+}
+
+func writeSecret(t *testing.T, dir string, ca, crt *testCert) {
+	for key, b := range map[string][]byte{SecretCAKey: ca.crtPEM, SecretCertificateKey: crt.crtPEM, SecretKeyKey: crt.keyPEM} {
+		if err := ioutil.WriteFile(filepath.Join(dir, key), b, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// countingSource counts the credentials loaded from the source.
+type countingSource struct {
+	CredentialsSource
+	loads *int
+}
+
+func (s countingSource) Load() (*client.Credentials, error) {
+	*s.loads++
+
+	return s.CredentialsSource.Load()
+}
+
+func TestReloadingCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nolint: errcheck
+	defer os.RemoveAll(dir)
+
+	ca := newCert(t, nil, "")
+	first := newCert(t, ca, "10.5.0.1")
+	second := newCert(t, ca, "10.5.0.1")
+
+	writeSecret(t, dir, ca, first)
+
+	loads := 0
+
+	creds, err := NewReloadingCredentials(countingSource{SecretSource{Dir: dir}, &loads})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := creds.Config("10.5.0.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := func(c *testCert) {
+		t.Helper()
+
+		got, err := cfg.GetClientCertificate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(got.Certificate[0], c.crt.Raw) {
+			t.Errorf("GetClientCertificate() did not return the certificate with serial %s", c.crt.SerialNumber)
+		}
+	}
+
+	want(first)
+	want(first)
+
+	if loads != 1 {
+		t.Errorf("loaded unchanged credentials %d times, want once", loads)
+	}
+
+	writeSecret(t, dir, ca, second)
+
+	// The files are written within the filesystem's timestamp granularity.
+	later := time.Now().Add(time.Minute)
+
+	for _, key := range []string{SecretCAKey, SecretCertificateKey, SecretKeyKey} {
+		if err = os.Chtimes(filepath.Join(dir, key), later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want(second)
+	want(second)
+
+	if loads != 2 {
+		t.Errorf("loaded credentials %d times, want twice", loads)
+	}
+
+	if err = os.Remove(filepath.Join(dir, SecretKeyKey)); err != nil {
+		t.Fatal(err)
+	}
+
+	want(second)
+}
+
+func TestVerifyPeer(t *testing.T) {
+	ca := newCert(t, nil, "")
+	other := newCert(t, nil, "")
+
+	tests := []struct {
+		name       string
+		server     *testCert
+		serverName string
+		wantErr    bool
+	}{
+		{name: "trusted", server: newCert(t, ca, "10.5.0.2"), serverName: "10.5.0.2"},
+		{name: "wrong name", server: newCert(t, ca, "10.5.0.3"), serverName: "10.5.0.2", wantErr: true},
+		{name: "untrusted", server: newCert(t, other, "10.5.0.2"), serverName: "10.5.0.2", wantErr: true},
+		{name: "no server name", server: newCert(t, ca, "10.5.0.2"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifyPeer(ca.crtPEM, tt.serverName, [][]byte{tt.server.crt.Raw}); (err != nil) != tt.wantErr {
+				t.Errorf("verifyPeer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,483 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upgrader
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/talos-systems/talos-controller-manager/pkg/tracing"
+	machineapi "github.com/talos-systems/talos/pkg/machinery/api/machine"
+	"github.com/talos-systems/talos/pkg/machinery/client"
+	talosconstants "github.com/talos-systems/talos/pkg/machinery/constants"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	// EndpointsEnvVar is a comma separated list of Talos API endpoints, such
+	// as a load balancer or VIP in front of the control plane.
+	EndpointsEnvVar = "TALOS_ENDPOINTS"
+	// EndpointsDNSEnvVar is a DNS name resolving to the Talos API endpoints.
+	EndpointsDNSEnvVar = "TALOS_ENDPOINTS_DNS"
+	// EndpointsSelectorEnvVar is a label selector of the nodes whose internal
+	// IPs are the Talos API endpoints.
+	EndpointsSelectorEnvVar = "TALOS_ENDPOINTS_SELECTOR"
+	// DirectEnvVar enables sending requests directly to each node's Talos
+	// API, instead of proxying them through the endpoints.
+	DirectEnvVar = "TALOS_DIRECT"
+)
+
+const (
+	// EndpointsRefreshInterval is how often the Talos API endpoints are
+	// refreshed.
+	EndpointsRefreshInterval = time.Minute
+
+	// closeDelay is how long a replaced client is kept open, so that the
+	// requests and log streams in flight on it can complete.
+	closeDelay = DefaultVersionConvergenceTimeout
+)
+
+// EndpointsSource returns the Talos API endpoints.
+type EndpointsSource interface {
+	Endpoints(context.Context) ([]string, error)
+}
+
+// StaticEndpoints are a fixed list of endpoints.
+type StaticEndpoints []string
+
+// Endpoints implements the EndpointsSource interface.
+func (e StaticEndpoints) Endpoints(context.Context) ([]string, error) {
+	return e, nil
+}
+
+// DNSEndpoints are the addresses the name resolves to.
+type DNSEndpoints struct {
+	Name string
+}
+
+// Endpoints implements the EndpointsSource interface.
+func (e DNSEndpoints) Endpoints(ctx context.Context) ([]string, error) {
+	return net.DefaultResolver.LookupHost(ctx, e.Name)
+}
+
+// NodeEndpoints are the addresses of the nodes matching the selector.
+type NodeEndpoints struct {
+	Client    kubernetes.Interface
+	Selector  labels.Selector
+	Addresses AddressSelector
+}
+
+// Endpoints implements the EndpointsSource interface.
+func (e NodeEndpoints) Endpoints(ctx context.Context) ([]string, error) {
+	nodes, err := e.Client.CoreV1().Nodes().List(metav1.ListOptions{LabelSelector: e.Selector.String()})
+	if err != nil {
+		return nil, err
+	}
+
+	var endpoints []string
+
+	for _, node := range nodes.Items {
+		if addr, err := e.Addresses.Address(node); err == nil {
+			endpoints = append(endpoints, addr)
+		}
+	}
+
+	return endpoints, nil
+}
+
+// APIServerEndpoints are the addresses of the Kubernetes API servers, which
+// run on the control plane nodes.
+type APIServerEndpoints struct {
+	Client kubernetes.Interface
+}
+
+// Endpoints implements the EndpointsSource interface.
+func (e APIServerEndpoints) Endpoints(ctx context.Context) ([]string, error) {
+	endpoints, err := e.Client.CoreV1().Endpoints(metav1.NamespaceDefault).Get("kubernetes", metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []string
+
+	for _, subset := range endpoints.Subsets {
+		for _, addr := range subset.Addresses {
+			addrs = append(addrs, addr.IP)
+		}
+	}
+
+	return addrs, nil
+}
+
+// NewEndpointsSource returns the source set by the TALOS_ENDPOINTS,
+// TALOS_ENDPOINTS_DNS or TALOS_ENDPOINTS_SELECTOR env vars, in that order.
+// The API server's endpoints are used if none are set.
+func NewEndpointsSource(clientset kubernetes.Interface, addresses AddressSelector) (EndpointsSource, error) {
+	if s, ok := os.LookupEnv(EndpointsEnvVar); ok {
+		var endpoints StaticEndpoints
+
+		for _, endpoint := range strings.Split(s, ",") {
+			if endpoint = strings.TrimSpace(endpoint); endpoint != "" {
+				endpoints = append(endpoints, endpoint)
+			}
+		}
+
+		return endpoints, nil
+	}
+
+	if name, ok := os.LookupEnv(EndpointsDNSEnvVar); ok {
+		return DNSEndpoints{Name: name}, nil
+	}
+
+	if s, ok := os.LookupEnv(EndpointsSelectorEnvVar); ok {
+		selector, err := labels.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", EndpointsSelectorEnvVar, err)
+		}
+
+		return NodeEndpoints{Client: clientset, Selector: selector, Addresses: addresses}, nil
+	}
+
+	return APIServerEndpoints{Client: clientset}, nil
+}
+
+// TalosClient is the Talos API client, which is rebuilt when the endpoints
+// returned by its source change. Requests are balanced across the endpoints
+// that are reachable, so that an unavailable endpoint does not fail them.
+type TalosClient struct {
+	// Direct sends requests to the node's Talos API, falling back to
+	// proxying them through the endpoints if the node can not be reached.
+	Direct bool
+	// Addresses selects the address requests to a node are sent to.
+	Addresses AddressSelector
+	// Nodes lists the nodes when the endpoints are refreshed, so that the
+	// direct clients of nodes that are gone, or whose address changed, are
+	// closed.
+	Nodes kubernetes.Interface
+
+	log    logr.Logger
+	source EndpointsSource
+	config TLSConfigFunc
+	port   int
+
+	mu        sync.RWMutex
+	endpoints []string
+	conn      *grpc.ClientConn
+	client    machineapi.MachineServiceClient
+	nodes     map[string]directClient
+}
+
+// directClient is the client connected to a node's Talos API, keyed by the
+// node's name.
+type directClient struct {
+	address string
+	conn    *grpc.ClientConn
+	client  machineapi.MachineServiceClient
+}
+
+func (d directClient) close() {
+	if d.conn != nil {
+		// nolint: errcheck
+		d.conn.Close()
+	}
+}
+
+// NewTalosClient returns a client connected to the source's current
+// endpoints.
+func NewTalosClient(ctx context.Context, source EndpointsSource, config TLSConfigFunc) (*TalosClient, error) {
+	c := &TalosClient{
+		log:    ctrl.Log.WithName("talos"),
+		source: source,
+		config: config,
+		port:   talosconstants.ApidPort,
+		nodes:  map[string]directClient{},
+	}
+
+	if err := c.Refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Client returns the current client.
+func (c *TalosClient) Client() machineapi.MachineServiceClient {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.client
+}
+
+// Do calls f with a client for the node. The proxied client is used unless
+// Direct is set, or if the node's Talos API can not be reached.
+func (c *TalosClient) Do(ctx context.Context, node corev1.Node, f func(context.Context, machineapi.MachineServiceClient) error) error {
+	addr, err := c.Addresses.Address(node)
+	if err != nil {
+		return err
+	}
+
+	if c.Direct {
+		nodeclient, err := c.direct(node.Name, addr)
+		if err == nil {
+			if err = f(ctx, nodeclient); !unreachable(err) {
+				return err
+			}
+		}
+
+		c.log.Info("node unreachable, proxying through the endpoints", "node", addr, "error", err.Error())
+	}
+
+	return f(client.WithNodes(ctx, addr), c.Client())
+}
+
+// unreachable returns true if the error is caused by the node not being
+// reachable, rather than by the request failing.
+func unreachable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+
+	var netErr net.Error
+
+	return errors.As(err, &netErr)
+}
+
+// direct returns the client connected to the node's Talos API. The client of
+// a node whose address changed is replaced.
+func (c *TalosClient) direct(name, addr string) (machineapi.MachineServiceClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if d, ok := c.nodes[name]; ok {
+		if d.address == addr {
+			return d.client, nil
+		}
+
+		d.close()
+		delete(c.nodes, name)
+	}
+
+	conn, err := c.dial([]string{addr})
+	if err != nil {
+		return nil, err
+	}
+
+	d := directClient{address: addr, conn: conn, client: machineapi.NewMachineServiceClient(conn)}
+	c.nodes[name] = d
+
+	return d.client, nil
+}
+
+// prune closes the direct clients of the nodes that are gone, or whose
+// address changed.
+func (c *TalosClient) prune(ctx context.Context) error {
+	if c.Nodes == nil {
+		return nil
+	}
+
+	nodes, err := c.Nodes.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	addresses := map[string]string{}
+
+	for _, node := range nodes.Items {
+		if addr, err := c.Addresses.Address(node); err == nil {
+			addresses[node.Name] = addr
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for name, d := range c.nodes {
+		if addr, ok := addresses[name]; !ok || addr != d.address {
+			d.close()
+			delete(c.nodes, name)
+		}
+	}
+
+	return nil
+}
+
+// closeNodes closes all the direct clients.
+func (c *TalosClient) closeNodes() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for name, d := range c.nodes {
+		d.close()
+		delete(c.nodes, name)
+	}
+}
+
+// dial returns a connection balancing requests across the endpoints with
+// the round_robin policy, which only picks the endpoints it is connected to.
+func (c *TalosClient) dial(endpoints []string) (*grpc.ClientConn, error) {
+	addrs := make([]resolver.Address, len(endpoints))
+
+	for i, endpoint := range endpoints {
+		addrs[i] = resolver.Address{Addr: net.JoinHostPort(endpoint, strconv.Itoa(c.port)), ServerName: endpoint}
+	}
+
+	r := manual.NewBuilderWithScheme("talos")
+	r.InitialState(resolver.State{Addresses: addrs})
+
+	opts := []grpc.DialOption{
+		grpc.WithResolvers(r),
+		grpc.WithTransportCredentials(endpointCredentials{credentials.NewTLS(&tls.Config{}), c.config}),
+		grpc.WithDefaultServiceConfig(`{"loadBalancingConfig": [{"round_robin": {}}]}`),
+	}
+
+	conn, err := grpc.Dial(r.Scheme()+":///endpoints", append(opts, tracing.DialOptions()...)...)
+	if err != nil {
+		return nil, fmt.Errorf("error constructing client: %w", err)
+	}
+
+	return conn, nil
+}
+
+// Refresh rebuilds the client if the source's endpoints changed.
+func (c *TalosClient) Refresh(ctx context.Context) error {
+	endpoints, err := c.source.Endpoints(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get Talos API endpoints: %w", err)
+	}
+
+	if len(endpoints) == 0 {
+		return errors.New("no Talos API endpoints found")
+	}
+
+	// The endpoints are sorted so that the same endpoints returned in a
+	// different order do not rebuild the client.
+	endpoints = append([]string(nil), endpoints...)
+	sort.Strings(endpoints)
+
+	c.mu.RLock()
+	unchanged := equal(endpoints, c.endpoints)
+	c.mu.RUnlock()
+
+	if unchanged {
+		return nil
+	}
+
+	conn, err := c.dial(endpoints)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	previous := c.conn
+	c.conn = conn
+	c.client = machineapi.NewMachineServiceClient(conn)
+	c.endpoints = endpoints
+	c.mu.Unlock()
+
+	c.log.Info("using Talos API endpoints", "endpoints", endpoints)
+
+	if previous != nil {
+		time.AfterFunc(closeDelay, func() {
+			// nolint: errcheck
+			previous.Close()
+		})
+	}
+
+	return nil
+}
+
+// endpointCredentials build the TLS configuration of each connection for the
+// endpoint it is made to, so that the endpoints balanced across by one client
+// are each verified against their own name.
+type endpointCredentials struct {
+	credentials.TransportCredentials
+	config TLSConfigFunc
+}
+
+// ClientHandshake implements the credentials.TransportCredentials interface.
+func (e endpointCredentials) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	host, _, err := net.SplitHostPort(authority)
+	if err != nil {
+		host = authority
+	}
+
+	cfg, err := e.config(host)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return credentials.NewTLS(cfg).ClientHandshake(ctx, authority, conn)
+}
+
+// Clone implements the credentials.TransportCredentials interface.
+func (e endpointCredentials) Clone() credentials.TransportCredentials {
+	return endpointCredentials{e.TransportCredentials.Clone(), e.config}
+}
+
+// Start refreshes the endpoints, and prunes the direct clients, every
+// EndpointsRefreshInterval until the stop channel is closed, when the direct
+// clients are closed. It implements the manager.Runnable interface, so that
+// the endpoints are only refreshed while the controller is the leader.
+func (c *TalosClient) Start(stop <-chan struct{}) error {
+	ticker := time.NewTicker(EndpointsRefreshInterval)
+	defer ticker.Stop()
+
+	defer c.closeNodes()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultRequestTimeout)
+
+		if err := c.Refresh(ctx); err != nil {
+			c.log.Error(err, "failed to refresh Talos API endpoints")
+		}
+
+		if err := c.prune(ctx); err != nil {
+			c.log.Error(err, "failed to prune Talos API node clients")
+		}
+
+		cancel()
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,279 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upgrader
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	machineapi "github.com/talos-systems/talos/pkg/machinery/api/machine"
+	talosconstants "github.com/talos-systems/talos/pkg/machinery/constants"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestNodeEndpoints(t *testing.T) {
+	master := newNode("master-1", true)
+	master.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.5.0.2"}}
+
+	worker := newNode("worker-1", false)
+	worker.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.5.0.3"}}
+
+	selector, err := labels.Parse(talosconstants.LabelNodeRoleMaster)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := NodeEndpoints{Client: fake.NewSimpleClientset(&master, &worker), Selector: selector}
+
+	endpoints, err := source.Endpoints(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"10.5.0.2"}; !reflect.DeepEqual(endpoints, want) {
+		t.Errorf("Endpoints() = %v, want %v", endpoints, want)
+	}
+}
+
+func TestTalosClientRefresh(t *testing.T) {
+	config := func(string) (*tls.Config, error) {
+		return &tls.Config{}, nil
+	}
+
+	source := StaticEndpoints{"10.5.0.3", "10.5.0.2"}
+
+	c, err := NewTalosClient(context.Background(), &source, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		endpoints StaticEndpoints
+		rebuilt   bool
+		wantErr   bool
+	}{
+		{name: "unchanged", endpoints: StaticEndpoints{"10.5.0.3", "10.5.0.2"}},
+		{name: "reordered", endpoints: StaticEndpoints{"10.5.0.2", "10.5.0.3"}},
+		{name: "replaced", endpoints: StaticEndpoints{"10.5.0.4", "10.5.0.3"}, rebuilt: true},
+		{name: "none", endpoints: StaticEndpoints{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := c.Client()
+			source = tt.endpoints
+
+			if err := c.Refresh(context.Background()); (err != nil) != tt.wantErr {
+				t.Fatalf("Refresh() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if rebuilt := c.Client() != previous; rebuilt != tt.rebuilt {
+				t.Errorf("Refresh() rebuilt = %v, want %v", rebuilt, tt.rebuilt)
+			}
+		})
+	}
+}
+
+func TestTalosClientDo(t *testing.T) {
+	config := func(string) (*tls.Config, error) {
+		return &tls.Config{}, nil
+	}
+
+	c, err := NewTalosClient(context.Background(), StaticEndpoints{"10.5.0.2"}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node := newNode("worker-1", false)
+	node.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.5.0.3"}}
+
+	tests := []struct {
+		name      string
+		direct    bool
+		directErr error
+		want      []string
+		wantErr   bool
+	}{
+		{name: "proxied", want: []string{"proxied"}},
+		{name: "direct", direct: true, want: []string{"direct"}},
+		{name: "unavailable", direct: true, directErr: status.Error(codes.Unavailable, "connection refused"), want: []string{"direct", "proxied"}},
+		{name: "deadline exceeded", direct: true, directErr: status.Error(codes.DeadlineExceeded, "timeout"), want: []string{"direct", "proxied"}},
+		{name: "connection error", direct: true, directErr: &net.OpError{Op: "dial", Err: errors.New("no route to host")}, want: []string{"direct", "proxied"}},
+		{name: "failed", direct: true, directErr: status.Error(codes.Internal, "failed"), want: []string{"direct"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.Direct = tt.direct
+
+			var got []string
+
+			err := c.Do(context.Background(), node, func(ctx context.Context, talosclient machineapi.MachineServiceClient) error {
+				md, _ := metadata.FromOutgoingContext(ctx)
+
+				if talosclient == c.Client() {
+					if nodes := md.Get("nodes"); !reflect.DeepEqual(nodes, []string{"10.5.0.3"}) {
+						t.Errorf("proxied request to nodes %v, want [10.5.0.3]", nodes)
+					}
+
+					got = append(got, "proxied")
+
+					return nil
+				}
+
+				if nodes := md.Get("nodes"); len(nodes) != 0 {
+					t.Errorf("direct request to nodes %v, want none", nodes)
+				}
+
+				got = append(got, "direct")
+
+				return tt.directErr
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Do() used %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTalosClientPrune(t *testing.T) {
+	config := func(string) (*tls.Config, error) {
+		return &tls.Config{}, nil
+	}
+
+	node := newNode("worker-1", false)
+	node.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.5.0.3"}}
+
+	moved := newNode("worker-2", false)
+	moved.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.5.0.5"}}
+
+	c, err := NewTalosClient(context.Background(), StaticEndpoints{"10.5.0.2"}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Nodes = fake.NewSimpleClientset(&node, &moved)
+
+	conns := map[string]*grpc.ClientConn{}
+
+	for name, addr := range map[string]string{"worker-1": "10.5.0.3", "worker-2": "10.5.0.4", "worker-3": "10.5.0.6"} {
+		if _, err = c.direct(name, addr); err != nil {
+			t.Fatal(err)
+		}
+
+		conns[name] = c.nodes[name].conn
+	}
+
+	if err = c.prune(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := c.nodes["worker-1"]; !ok {
+		t.Error("prune() closed the client of worker-1")
+	}
+
+	for _, name := range []string{"worker-2", "worker-3"} {
+		if _, ok := c.nodes[name]; ok {
+			t.Errorf("prune() kept the client of %s", name)
+		}
+
+		if state := conns[name].GetState(); state != connectivity.Shutdown {
+			t.Errorf("%s connection state = %s, want %s", name, state, connectivity.Shutdown)
+		}
+	}
+
+	c.closeNodes()
+
+	if state := conns["worker-1"].GetState(); state != connectivity.Shutdown {
+		t.Errorf("worker-1 connection state = %s, want %s", state, connectivity.Shutdown)
+	}
+}
+
+type versionServer struct {
+	machineapi.UnimplementedMachineServiceServer
+}
+
+func (versionServer) Version(context.Context, *emptypb.Empty) (*machineapi.VersionResponse, error) {
+	return &machineapi.VersionResponse{Messages: []*machineapi.Version{{Version: &machineapi.VersionInfo{Tag: "v0.9.0"}}}}, nil
+}
+
+func TestTalosClientFailover(t *testing.T) {
+	ca := newCert(t, nil, "")
+	crt := newCert(t, ca, "127.0.0.2")
+
+	keyPair, err := tls.X509KeyPair(crt.crtPEM, crt.keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the second endpoint is listening, so that requests must fail
+	// over from the first.
+	lis, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{keyPair}})))
+	machineapi.RegisterMachineServiceServer(server, versionServer{})
+
+	// nolint: errcheck
+	go server.Serve(lis)
+
+	defer server.Stop()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.crt)
+
+	config := func(serverName string) (*tls.Config, error) {
+		return &tls.Config{RootCAs: roots, ServerName: serverName}, nil
+	}
+
+	c := &TalosClient{
+		log:    ctrl.Log,
+		source: StaticEndpoints{"127.0.0.1", "127.0.0.2"},
+		config: config,
+		port:   lis.Addr().(*net.TCPAddr).Port,
+		nodes:  map[string]directClient{},
+	}
+
+	if err = c.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+		resp, err := c.Client().Version(ctx, &emptypb.Empty{})
+
+		cancel()
+
+		if err != nil {
+			t.Fatalf("Version() error = %v", err)
+		}
+
+		if tag := resp.Messages[0].Version.Tag; tag != "v0.9.0" {
+			t.Errorf("Version() = %s, want v0.9.0", tag)
+		}
+	}
+}
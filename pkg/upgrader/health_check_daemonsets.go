@@ -0,0 +1,61 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upgrader
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DaemonSetsCheck passes when the DaemonSet pods scheduled to the node are
+// running and ready.
+type DaemonSetsCheck struct {
+	Client kubernetes.Interface
+}
+
+func (check DaemonSetsCheck) Name() string {
+	return "DaemonSets"
+}
+
+func (check DaemonSetsCheck) Check(ctx context.Context, node corev1.Node) error {
+	pods, err := check.Client.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", node.Name).String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, pod := range pods.Items {
+		owner := metav1.GetControllerOf(&pod)
+		if owner == nil || owner.Kind != "DaemonSet" {
+			continue
+		}
+
+		if !podReady(pod) {
+			return fmt.Errorf("pod %s/%s is not ready", pod.Namespace, pod.Name)
+		}
+	}
+
+	return nil
+}
+
+func podReady(pod corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodRunning {
+		return false
+	}
+
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
+}
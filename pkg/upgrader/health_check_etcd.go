@@ -0,0 +1,85 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upgrader
+
+import (
+	"context"
+	"fmt"
+
+	machineapi "github.com/talos-systems/talos/pkg/machinery/api/machine"
+	"github.com/talos-systems/talos/pkg/machinery/client"
+	"google.golang.org/protobuf/types/known/emptypb"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// EtcdCheck passes when the etcd service is healthy on every control plane
+// node. Nodes that are not part of the control plane always pass.
+type EtcdCheck struct {
+	Kubernetes kubernetes.Interface
+	Talos      *TalosClient
+}
+
+func (check EtcdCheck) Name() string {
+	return "Etcd"
+}
+
+func (check EtcdCheck) Check(ctx context.Context, node corev1.Node) error {
+	if !IsControlPlane(node) {
+		return nil
+	}
+
+	// Control plane nodes are labelled with either role, so they can not be
+	// listed with one selector.
+	nodes, err := check.Kubernetes.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	var members []string
+
+	for _, member := range nodes.Items {
+		if !IsControlPlane(member) {
+			continue
+		}
+
+		addr, err := check.Talos.Addresses.Address(member)
+		if err != nil {
+			return err
+		}
+
+		members = append(members, addr)
+	}
+
+	reply, err := client.FilterMessages(check.Talos.Client().ServiceList(client.WithNodes(ctx, members...), &emptypb.Empty{}))
+	if err != nil {
+		return err
+	}
+
+	resp, _ := reply.(*machineapi.ServiceListResponse)
+
+	healthy := 0
+
+	for _, msg := range resp.GetMessages() {
+		for _, svc := range msg.Services {
+			if svc.Id != "etcd" {
+				continue
+			}
+
+			if err = serviceHealthy(svc); err != nil {
+				return fmt.Errorf("%s: %w", msg.Metadata.GetHostname(), err)
+			}
+
+			healthy++
+		}
+	}
+
+	if healthy < len(members) {
+		return fmt.Errorf("%d of %d etcd members are healthy", healthy, len(members))
+	}
+
+	return nil
+}
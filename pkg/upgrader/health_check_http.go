@@ -0,0 +1,73 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upgrader
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// HTTPCheck passes when a GET request to the URL responds with a 2xx or 3xx
+// status. $(NODE_NAME) and $(NODE_IP) in the URL are replaced with the node's
+// name and address, which is enclosed in brackets if it is an IPv6 address.
+type HTTPCheck struct {
+	Client    *http.Client
+	CheckName string
+	URL       string
+	Addresses AddressSelector
+}
+
+func (check HTTPCheck) Name() string {
+	return check.CheckName
+}
+
+func (check HTTPCheck) Check(ctx context.Context, node corev1.Node) error {
+	u := strings.Replace(check.URL, "$(NODE_NAME)", node.Name, -1)
+
+	if strings.Contains(u, "$(NODE_IP)") {
+		addr, err := check.Addresses.Address(node)
+		if err != nil {
+			return err
+		}
+
+		host := addr
+		if ip := net.ParseIP(addr); ip != nil && ip.To4() == nil {
+			host = "[" + addr + "]"
+		}
+
+		// URLs that already enclose the address in brackets are supported.
+		u = strings.Replace(u, "[$(NODE_IP)]", host, -1)
+		u = strings.Replace(u, "$(NODE_IP)", host, -1)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+
+	c := check.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	// nolint: errcheck
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("%s responded with %s", u, resp.Status)
+	}
+
+	return nil
+}
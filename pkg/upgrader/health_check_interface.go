@@ -0,0 +1,18 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upgrader
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+type HealthCheck interface {
+	// Name identifies the check in the node's status.
+	Name() string
+	// Check returns an error describing why the node is not healthy.
+	Check(context.Context, corev1.Node) error
+}
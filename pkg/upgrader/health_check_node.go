@@ -0,0 +1,45 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upgrader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NodeReadyCheck passes when the node's Ready condition is True.
+type NodeReadyCheck struct {
+	Client kubernetes.Interface
+}
+
+func (check NodeReadyCheck) Name() string {
+	return "NodeReady"
+}
+
+func (check NodeReadyCheck) Check(ctx context.Context, node corev1.Node) error {
+	n, err := check.Client.CoreV1().Nodes().Get(node.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	for _, condition := range n.Status.Conditions {
+		if condition.Type != corev1.NodeReady {
+			continue
+		}
+
+		if condition.Status != corev1.ConditionTrue {
+			return fmt.Errorf("node is not ready: Ready is %s", condition.Status)
+		}
+
+		return nil
+	}
+
+	return errors.New("node is not ready: no Ready condition")
+}
@@ -0,0 +1,49 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upgrader
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PodCheck passes when at least one pod matches the selector, and all of the
+// matching pods are ready.
+type PodCheck struct {
+	Client    kubernetes.Interface
+	CheckName string
+	Namespace string
+	Selector  labels.Selector
+}
+
+func (check PodCheck) Name() string {
+	return check.CheckName
+}
+
+func (check PodCheck) Check(ctx context.Context, node corev1.Node) error {
+	pods, err := check.Client.CoreV1().Pods(check.Namespace).List(metav1.ListOptions{
+		LabelSelector: check.Selector.String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(pods.Items) == 0 {
+		return fmt.Errorf("no pods match %q", check.Selector.String())
+	}
+
+	for _, pod := range pods.Items {
+		if !podReady(pod) {
+			return fmt.Errorf("pod %s/%s is not ready", pod.Namespace, pod.Name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upgrader
+
+import (
+	"context"
+	"fmt"
+
+	machineapi "github.com/talos-systems/talos/pkg/machinery/api/machine"
+	"github.com/talos-systems/talos/pkg/machinery/client"
+	"google.golang.org/protobuf/types/known/emptypb"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ServicesCheck passes when the Talos services on the node are running and
+// healthy. Services without a health check only need to be running.
+type ServicesCheck struct {
+	Client   *TalosClient
+	Services []string
+}
+
+func (check ServicesCheck) Name() string {
+	return "Services"
+}
+
+func (check ServicesCheck) Check(ctx context.Context, node corev1.Node) error {
+	var resp *machineapi.ServiceListResponse
+
+	err := check.Client.Do(ctx, node, func(ctx context.Context, c machineapi.MachineServiceClient) error {
+		reply, err := client.FilterMessages(c.ServiceList(ctx, &emptypb.Empty{}))
+		resp, _ = reply.(*machineapi.ServiceListResponse)
+
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	services := map[string]*machineapi.ServiceInfo{}
+
+	for _, msg := range resp.GetMessages() {
+		for _, svc := range msg.Services {
+			services[svc.Id] = svc
+		}
+	}
+
+	for _, id := range check.Services {
+		svc, ok := services[id]
+		if !ok {
+			return fmt.Errorf("service %q is not registered", id)
+		}
+
+		if err = serviceHealthy(svc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func serviceHealthy(svc *machineapi.ServiceInfo) error {
+	if svc.State != "Running" {
+		return fmt.Errorf("service %q is %s", svc.Id, svc.State)
+	}
+
+	if svc.Health != nil && !svc.Health.Unknown && !svc.Health.Healthy {
+		return fmt.Errorf("service %q is not healthy: %s", svc.Id, svc.Health.LastMessage)
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upgrader
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newPod(name, node string, ready bool, labels map[string]string, owner string) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: labels},
+		Spec:       corev1.PodSpec{NodeName: node},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+
+	if owner != "" {
+		controller := true
+		pod.OwnerReferences = []metav1.OwnerReference{{Kind: owner, Name: owner, Controller: &controller}}
+	}
+
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+
+	pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: status}}
+
+	return pod
+}
+
+func newReadyNode(name string, status corev1.ConditionStatus) *corev1.Node {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+
+	if status != "" {
+		node.Status.Conditions = []corev1.NodeCondition{{Type: corev1.NodeReady, Status: status}}
+	}
+
+	return node
+}
+
+// roundTripFunc responds with the status returned for the request.
+type roundTripFunc func(*http.Request) int
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: f(req), Body: ioutil.NopCloser(strings.NewReader("")), Request: req}, nil
+}
+
+func TestHealthChecks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz/node-1" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	// The client only reaches the node's IPv6 address as a URL host.
+	ipv6 := &http.Client{Transport: roundTripFunc(func(req *http.Request) int {
+		if req.URL.Host != "[fd00::1]:8080" {
+			return http.StatusBadGateway
+		}
+
+		return http.StatusOK
+	})}
+
+	app := labels.SelectorFromSet(labels.Set{"app": "storage"})
+
+	node := corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}
+	node.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "fd00::1"}}
+
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		check   func(*fake.Clientset) HealthCheck
+		wantErr bool
+	}{
+		{
+			name:    "node ready",
+			objects: []runtime.Object{newReadyNode("node-1", corev1.ConditionTrue)},
+			check:   func(c *fake.Clientset) HealthCheck { return NodeReadyCheck{Client: c} },
+		},
+		{
+			name:    "node not ready",
+			objects: []runtime.Object{newReadyNode("node-1", corev1.ConditionFalse)},
+			check:   func(c *fake.Clientset) HealthCheck { return NodeReadyCheck{Client: c} },
+			wantErr: true,
+		},
+		{
+			name:    "node readiness unknown",
+			objects: []runtime.Object{newReadyNode("node-1", corev1.ConditionUnknown)},
+			check:   func(c *fake.Clientset) HealthCheck { return NodeReadyCheck{Client: c} },
+			wantErr: true,
+		},
+		{
+			name:    "node without ready condition",
+			objects: []runtime.Object{newReadyNode("node-1", "")},
+			check:   func(c *fake.Clientset) HealthCheck { return NodeReadyCheck{Client: c} },
+			wantErr: true,
+		},
+		{
+			name:    "daemonset pods ready",
+			objects: []runtime.Object{newPod("cni", "node-1", true, nil, "DaemonSet"), newPod("app", "node-1", false, nil, "ReplicaSet")},
+			check:   func(c *fake.Clientset) HealthCheck { return DaemonSetsCheck{Client: c} },
+		},
+		{
+			name:    "daemonset pod not ready",
+			objects: []runtime.Object{newPod("cni", "node-1", false, nil, "DaemonSet")},
+			check:   func(c *fake.Clientset) HealthCheck { return DaemonSetsCheck{Client: c} },
+			wantErr: true,
+		},
+		{
+			name:    "selected pods ready",
+			objects: []runtime.Object{newPod("storage", "node-2", true, map[string]string{"app": "storage"}, "")},
+			check: func(c *fake.Clientset) HealthCheck {
+				return PodCheck{Client: c, Namespace: "default", Selector: app}
+			},
+		},
+		{
+			name:    "no selected pods",
+			objects: []runtime.Object{newPod("other", "node-1", true, nil, "")},
+			check: func(c *fake.Clientset) HealthCheck {
+				return PodCheck{Client: c, Namespace: "default", Selector: app}
+			},
+			wantErr: true,
+		},
+		{
+			name:  "http probe",
+			check: func(c *fake.Clientset) HealthCheck { return HTTPCheck{URL: server.URL + "/healthz/$(NODE_NAME)"} },
+		},
+		{
+			name: "http probe on IPv6",
+			check: func(c *fake.Clientset) HealthCheck {
+				return HTTPCheck{Client: ipv6, URL: "http://$(NODE_IP):8080/healthz"}
+			},
+		},
+		{
+			name: "http probe on IPv6 in brackets",
+			check: func(c *fake.Clientset) HealthCheck {
+				return HTTPCheck{Client: ipv6, URL: "http://[$(NODE_IP)]:8080/healthz"}
+			},
+		},
+		{
+			name:    "http probe failing",
+			check:   func(c *fake.Clientset) HealthCheck { return HTTPCheck{URL: server.URL + "/unhealthy"} },
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := tt.check(fake.NewSimpleClientset(tt.objects...))
+
+			if err := check.Check(context.Background(), node); (err != nil) != tt.wantErr {
+				t.Errorf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
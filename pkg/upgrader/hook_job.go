@@ -0,0 +1,199 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upgrader
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
+	"github.com/talos-systems/talos-controller-manager/pkg/constants"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	PreUpgradeHook  = "pre-upgrade"
+	PostUpgradeHook = "post-upgrade"
+)
+
+// DefaultMaxHookAttempts is the default number of attempts whose Jobs are
+// kept for each node and hook.
+const DefaultMaxHookAttempts = 3
+
+// HookError is returned when a hook's Job fails.
+type HookError struct {
+	job    string
+	reason string
+}
+
+func NewHookError(job, reason string) HookError {
+	return HookError{job, reason}
+}
+
+func (h HookError) Error() string {
+	return fmt.Sprintf("job %s failed: %s", h.job, h.reason)
+}
+
+// HookJob runs a pool's hooks as Jobs created from the job template of a
+// CronJob, which is the only built-in object holding a Job template without
+// running it. The Jobs of each node's oldest attempts are deleted, keeping the
+// last MaxAttempts.
+type HookJob struct {
+	Client      kubernetes.Interface
+	MaxAttempts int
+}
+
+// Run creates the hook's Job for the node, if it does not exist yet, and
+// returns true once it has completed. A HookError is returned if the Job
+// failed.
+func (h HookJob) Run(pool *poolv1alpha1.Pool, name string, hook *poolv1alpha1.Hook, nodeStatus *poolv1alpha1.NodeStatus) (bool, error) {
+	jobName := attemptName(pool.Name, name, nodeStatus)
+
+	job, err := h.Client.BatchV1().Jobs(hook.Namespace).Get(jobName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, h.create(pool, name, jobName, hook, nodeStatus)
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+
+		switch condition.Type {
+		case batchv1.JobComplete:
+			return true, nil
+		case batchv1.JobFailed:
+			return false, NewHookError(jobName, condition.Message)
+		}
+	}
+
+	return false, nil
+}
+
+func (h HookJob) create(pool *poolv1alpha1.Pool, name, jobName string, hook *poolv1alpha1.Hook, nodeStatus *poolv1alpha1.NodeStatus) error {
+	cronJob, err := h.Client.BatchV1beta1().CronJobs(hook.Namespace).Get(hook.CronJob, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get the %s hook's template: %w", name, err)
+	}
+
+	template := cronJob.Spec.JobTemplate
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        jobName,
+			Namespace:   hook.Namespace,
+			Labels:      map[string]string{},
+			Annotations: map[string]string{},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(pool, poolv1alpha1.GroupVersion.WithKind("Pool")),
+			},
+		},
+		Spec: *template.Spec.DeepCopy(),
+	}
+
+	for k, v := range template.Labels {
+		job.Labels[k] = v
+	}
+
+	for k, v := range template.Annotations {
+		job.Annotations[k] = v
+	}
+
+	job.Labels[constants.V1Alpha1PoolLabel] = pool.Name
+	job.Labels[constants.V1Alpha1HookLabel] = name
+	job.Annotations[constants.V1Alpha1NodeAnnotation] = nodeStatus.Name
+
+	env := []corev1.EnvVar{
+		{Name: "POOL_NAME", Value: pool.Name},
+		{Name: "NODE_NAME", Value: nodeStatus.Name},
+		{Name: "PREVIOUS_VERSION", Value: nodeStatus.PreviousVersion},
+		{Name: "TARGET_VERSION", Value: nodeStatus.TargetVersion},
+	}
+
+	containers := job.Spec.Template.Spec.Containers
+	for i := range containers {
+		containers[i].Env = append(containers[i].Env, env...)
+	}
+
+	_, err = h.Client.BatchV1().Jobs(hook.Namespace).Create(job)
+	if apierrors.IsAlreadyExists(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return h.prune(pool, name, jobName, hook, nodeStatus)
+}
+
+// prune deletes the Jobs of the node's oldest attempts of the hook, keeping
+// the last MaxAttempts.
+func (h HookJob) prune(pool *poolv1alpha1.Pool, name, jobName string, hook *poolv1alpha1.Hook, nodeStatus *poolv1alpha1.NodeStatus) error {
+	max := h.MaxAttempts
+	if max <= 0 {
+		max = DefaultMaxHookAttempts
+	}
+
+	list, err := h.Client.BatchV1().Jobs(hook.Namespace).List(metav1.ListOptions{
+		LabelSelector: constants.V1Alpha1PoolLabel + "=" + pool.Name + "," + constants.V1Alpha1HookLabel + "=" + name,
+	})
+	if err != nil {
+		return err
+	}
+
+	// The Jobs of the node's previous attempts.
+	var jobs []batchv1.Job
+
+	for _, job := range list.Items {
+		if job.Annotations[constants.V1Alpha1NodeAnnotation] == nodeStatus.Name && job.Name != jobName {
+			jobs = append(jobs, job)
+		}
+	}
+
+	if len(jobs) < max {
+		return nil
+	}
+
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].CreationTimestamp.Before(&jobs[j].CreationTimestamp)
+	})
+
+	// The Jobs' pods are deleted with them.
+	propagation := metav1.DeletePropagationBackground
+
+	for _, job := range jobs[:len(jobs)-max+1] {
+		err = h.Client.BatchV1().Jobs(hook.Namespace).Delete(job.Name, &metav1.DeleteOptions{PropagationPolicy: &propagation})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// attemptName returns a name for the object created for the node's current
+// phase, such as a hook's Job, that is unique to the attempt.
+func attemptName(pool, name string, nodeStatus *poolv1alpha1.NodeStatus) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s/%s/%s/%d", pool, name, nodeStatus.Name, nodeStatus.LastTransitionTime.Unix())))
+
+	prefix := fmt.Sprintf("%s-%s-%s", pool, name, nodeStatus.Name)
+	if len(prefix) > 52 {
+		prefix = prefix[:52]
+	}
+
+	return strings.TrimRight(prefix, "-.") + "-" + hex.EncodeToString(sum[:5])
+}
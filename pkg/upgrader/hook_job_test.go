@@ -0,0 +1,154 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upgrader
+
+import (
+	"testing"
+
+	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestHookJob(t *testing.T) {
+	cronJob := &batchv1beta1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "snapshot", Namespace: "ops"},
+		Spec: batchv1beta1.CronJobSpec{
+			JobTemplate: batchv1beta1.JobTemplateSpec{
+				Spec: batchv1.JobSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "snapshot"}}},
+					},
+				},
+			},
+		},
+	}
+
+	pool := &poolv1alpha1.Pool{ObjectMeta: metav1.ObjectMeta{Name: "masters"}}
+	hook := &poolv1alpha1.Hook{Namespace: "ops", CronJob: "snapshot"}
+	nodeStatus := &poolv1alpha1.NodeStatus{Name: "master-1", PreviousVersion: "v0.3.0", TargetVersion: "v0.4.0"}
+
+	h := HookJob{Client: fake.NewSimpleClientset(cronJob)}
+
+	if done, err := h.Run(pool, PreUpgradeHook, hook, nodeStatus); done || err != nil {
+		t.Fatalf("Run() = %v, %v, want false, nil", done, err)
+	}
+
+	jobs, err := h.Client.BatchV1().Jobs("ops").List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(jobs.Items) != 1 {
+		t.Fatalf("got %d jobs, want 1", len(jobs.Items))
+	}
+
+	job := jobs.Items[0]
+
+	env := map[string]string{}
+	for _, e := range job.Spec.Template.Spec.Containers[0].Env {
+		env[e.Name] = e.Value
+	}
+
+	if env["NODE_NAME"] != "master-1" || env["PREVIOUS_VERSION"] != "v0.3.0" || env["TARGET_VERSION"] != "v0.4.0" {
+		t.Errorf("unexpected env %v", env)
+	}
+
+	for _, tt := range []struct {
+		condition batchv1.JobConditionType
+		wantDone  bool
+		wantErr   bool
+	}{
+		{condition: batchv1.JobFailed, wantErr: true},
+		{condition: batchv1.JobComplete, wantDone: true},
+	} {
+		job.Status.Conditions = []batchv1.JobCondition{{Type: tt.condition, Status: corev1.ConditionTrue}}
+
+		if _, err = h.Client.BatchV1().Jobs("ops").Update(&job); err != nil {
+			t.Fatal(err)
+		}
+
+		done, err := h.Run(pool, PreUpgradeHook, hook, nodeStatus)
+		if _, ok := err.(HookError); ok != tt.wantErr || done != tt.wantDone {
+			t.Errorf("Run() = %v, %v, want done %v, error %v", done, err, tt.wantDone, tt.wantErr)
+		}
+	}
+}
+
+func TestHookJobPrune(t *testing.T) {
+	cronJob := &batchv1beta1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "snapshot", Namespace: "ops"},
+		Spec: batchv1beta1.CronJobSpec{
+			JobTemplate: batchv1beta1.JobTemplateSpec{
+				Spec: batchv1.JobSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "snapshot"}}},
+					},
+				},
+			},
+		},
+	}
+
+	pool := &poolv1alpha1.Pool{ObjectMeta: metav1.ObjectMeta{Name: "masters"}}
+	hook := &poolv1alpha1.Hook{Namespace: "ops", CronJob: "snapshot"}
+
+	h := HookJob{Client: fake.NewSimpleClientset(cronJob)}
+
+	var names []string
+
+	for i := 0; i < 5; i++ {
+		nodeStatus := &poolv1alpha1.NodeStatus{Name: "master-1", LastTransitionTime: metav1.Unix(int64(i), 0)}
+
+		if _, err := h.Run(pool, PreUpgradeHook, hook, nodeStatus); err != nil {
+			t.Fatal(err)
+		}
+
+		names = append(names, attemptName(pool.Name, PreUpgradeHook, nodeStatus))
+
+		// The fake clientset does not set creation timestamps.
+		job, err := h.Client.BatchV1().Jobs("ops").Get(names[i], metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		job.CreationTimestamp = metav1.Unix(int64(i), 0)
+
+		if _, err = h.Client.BatchV1().Jobs("ops").Update(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Another node's attempt is not pruned.
+	other := &poolv1alpha1.NodeStatus{Name: "master-2"}
+
+	if _, err := h.Run(pool, PreUpgradeHook, hook, other); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := h.Client.BatchV1().Jobs("ops").List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]bool{}
+	for _, job := range jobs.Items {
+		got[job.Name] = true
+	}
+
+	want := append(names[2:], attemptName(pool.Name, PreUpgradeHook, other))
+
+	if len(got) != len(want) {
+		t.Errorf("got %d jobs, want %d", len(got), len(want))
+	}
+
+	for _, name := range want {
+		if !got[name] {
+			t.Errorf("job %s was pruned", name)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upgrader
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
+	"github.com/talos-systems/talos-controller-manager/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// LogDirEnvVar is the directory upgrade logs are written to, such as a
+	// mounted PersistentVolumeClaim, instead of ConfigMaps.
+	LogDirEnvVar = "TALOS_LOG_DIR"
+
+	// LogKey is the key of the log in a ConfigMap.
+	LogKey = "log"
+
+	// DefaultMaxLogBytes is the default size ConfigMap logs are bounded to,
+	// well below the size limit of ConfigMaps.
+	DefaultMaxLogBytes = 512 * 1024
+
+	// DefaultMaxLogAttempts is the default number of attempts whose
+	// ConfigMap logs are kept for each node.
+	DefaultMaxLogAttempts = 3
+
+	// logFlushInterval is how often captured logs are written to the sink.
+	logFlushInterval = 10 * time.Second
+)
+
+// LogAttempt identifies the log of a node's upgrade attempt.
+type LogAttempt struct {
+	Pool *poolv1alpha1.Pool
+	Node string
+	// Name is unique to the attempt.
+	Name string
+}
+
+// NewLogAttempt returns the log of the node's current attempt.
+func NewLogAttempt(pool *poolv1alpha1.Pool, nodeStatus *poolv1alpha1.NodeStatus) LogAttempt {
+	return LogAttempt{
+		Pool: pool.DeepCopy(),
+		Node: nodeStatus.Name,
+		Name: attemptName(pool.Name, "log", nodeStatus),
+	}
+}
+
+// LogSink stores the upgrade logs of nodes.
+type LogSink interface {
+	// Append appends the data to the attempt's log.
+	Append(context.Context, LogAttempt, []byte) error
+	// Ref returns the reference to the attempt's log that is linked from
+	// the node's status.
+	Ref(LogAttempt) string
+}
+
+// ConfigMapLogSink stores each attempt's log in a ConfigMap owned by the
+// pool, dropping the oldest lines once the log exceeds MaxBytes. The logs of
+// the last MaxAttempts attempts of each node are kept.
+type ConfigMapLogSink struct {
+	Client      kubernetes.Interface
+	Namespace   string
+	MaxBytes    int
+	MaxAttempts int
+}
+
+// Append implements the LogSink interface.
+func (s ConfigMapLogSink) Append(ctx context.Context, attempt LogAttempt, data []byte) error {
+	max := s.MaxBytes
+	if max <= 0 {
+		max = DefaultMaxLogBytes
+	}
+
+	configMap, err := s.Client.CoreV1().ConfigMaps(s.Namespace).Get(attempt.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        attempt.Name,
+				Namespace:   s.Namespace,
+				Labels:      map[string]string{constants.V1Alpha1PoolLabel: attempt.Pool.Name},
+				Annotations: map[string]string{constants.V1Alpha1NodeAnnotation: attempt.Node},
+				OwnerReferences: []metav1.OwnerReference{
+					*metav1.NewControllerRef(attempt.Pool, poolv1alpha1.GroupVersion.WithKind("Pool")),
+				},
+			},
+			Data: map[string]string{LogKey: string(bounded(data, max))},
+		}
+
+		if _, err = s.Client.CoreV1().ConfigMaps(s.Namespace).Create(configMap); err != nil {
+			return err
+		}
+
+		return s.prune(attempt)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if configMap.Data == nil {
+		configMap.Data = map[string]string{}
+	}
+
+	configMap.Data[LogKey] = string(bounded(append([]byte(configMap.Data[LogKey]), data...), max))
+
+	_, err = s.Client.CoreV1().ConfigMaps(s.Namespace).Update(configMap)
+
+	return err
+}
+
+// Ref implements the LogSink interface.
+func (s ConfigMapLogSink) Ref(attempt LogAttempt) string {
+	return "configmap/" + s.Namespace + "/" + attempt.Name
+}
+
+// prune deletes the logs of the node's oldest attempts, keeping the last
+// MaxAttempts.
+func (s ConfigMapLogSink) prune(attempt LogAttempt) error {
+	max := s.MaxAttempts
+	if max <= 0 {
+		max = DefaultMaxLogAttempts
+	}
+
+	list, err := s.Client.CoreV1().ConfigMaps(s.Namespace).List(metav1.ListOptions{
+		LabelSelector: constants.V1Alpha1PoolLabel + "=" + attempt.Pool.Name,
+	})
+	if err != nil {
+		return err
+	}
+
+	// The logs of the node's previous attempts.
+	var logs []corev1.ConfigMap
+
+	for _, configMap := range list.Items {
+		if configMap.Annotations[constants.V1Alpha1NodeAnnotation] == attempt.Node && configMap.Name != attempt.Name {
+			logs = append(logs, configMap)
+		}
+	}
+
+	if len(logs) < max {
+		return nil
+	}
+
+	sort.SliceStable(logs, func(i, j int) bool {
+		return logs[i].CreationTimestamp.Before(&logs[j].CreationTimestamp)
+	})
+
+	for _, configMap := range logs[:len(logs)-max+1] {
+		err = s.Client.CoreV1().ConfigMaps(s.Namespace).Delete(configMap.Name, &metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FileLogSink stores each attempt's log in a file in the directory, such as
+// a mounted PersistentVolumeClaim.
+type FileLogSink struct {
+	Dir string
+}
+
+// Append implements the LogSink interface.
+func (s FileLogSink) Append(ctx context.Context, attempt LogAttempt, data []byte) error {
+	f, err := os.OpenFile(s.Ref(attempt), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.Write(data); err != nil {
+		// nolint: errcheck
+		f.Close()
+
+		return err
+	}
+
+	return f.Close()
+}
+
+// Ref implements the LogSink interface.
+func (s FileLogSink) Ref(attempt LogAttempt) string {
+	return filepath.Join(s.Dir, attempt.Name+".log")
+}
+
+// bounded returns the last max bytes of the data, starting at a line.
+func bounded(data []byte, max int) []byte {
+	if len(data) <= max {
+		return data
+	}
+
+	data = data[len(data)-max:]
+
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		data = data[i+1:]
+	}
+
+	return data
+}
+
+// logWriter copies a node's log to the controller's log, and buffers it to
+// write it to the sink every logFlushInterval. A buffer that fails to be
+// written is kept for the next attempt.
+type logWriter struct {
+	log     logr.Logger
+	sink    LogSink
+	attempt LogAttempt
+
+	buf     []byte
+	flushed time.Time
+}
+
+func (w *logWriter) write(ctx context.Context, data []byte) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		w.log.Info("upgrade log", "node", w.attempt.Node, "log", scanner.Text())
+	}
+
+	w.buf = bounded(append(w.buf, data...), DefaultMaxLogBytes)
+
+	if time.Since(w.flushed) >= logFlushInterval {
+		w.flush(ctx)
+	}
+}
+
+func (w *logWriter) flush(ctx context.Context) {
+	if len(w.buf) == 0 {
+		return
+	}
+
+	w.flushed = time.Now()
+
+	if err := w.sink.Append(ctx, w.attempt, w.buf); err != nil {
+		w.log.Error(err, "failed to store upgrade log", "node", w.attempt.Node)
+
+		return
+	}
+
+	w.buf = nil
+}
@@ -0,0 +1,186 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upgrader
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
+	"github.com/talos-systems/talos-controller-manager/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLogSinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nolint: errcheck
+	defer os.RemoveAll(dir)
+
+	clientset := fake.NewSimpleClientset()
+
+	pool := &poolv1alpha1.Pool{ObjectMeta: metav1.ObjectMeta{Name: "workers", UID: "uid"}}
+	attempt := NewLogAttempt(pool, &poolv1alpha1.NodeStatus{Name: "worker-1"})
+
+	tests := []struct {
+		name string
+		sink LogSink
+		read func() string
+		want string
+	}{
+		{
+			name: "configmap",
+			sink: ConfigMapLogSink{Client: clientset, Namespace: "talos-system", MaxBytes: 20},
+			read: func() string {
+				configMap, err := clientset.CoreV1().ConfigMaps("talos-system").Get(attempt.Name, metav1.GetOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(configMap.OwnerReferences) != 1 || configMap.OwnerReferences[0].UID != pool.UID {
+					t.Errorf("ConfigMap is not owned by the pool: %v", configMap.OwnerReferences)
+				}
+
+				return configMap.Data[LogKey]
+			},
+			want: "second\nthird\n",
+		},
+		{
+			name: "file",
+			sink: FileLogSink{Dir: dir},
+			read: func() string {
+				b, err := ioutil.ReadFile(FileLogSink{Dir: dir}.Ref(attempt))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return string(b)
+			},
+			want: "installing\nsecond\nthird\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, data := range []string{"installing\n", "second\nthird\n"} {
+				if err := tt.sink.Append(context.Background(), attempt, []byte(data)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got := tt.read(); got != tt.want {
+				t.Errorf("log = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigMapLogSinkRetention(t *testing.T) {
+	pool := &poolv1alpha1.Pool{ObjectMeta: metav1.ObjectMeta{Name: "workers", UID: "uid"}}
+
+	log := func(name, node string, age time.Duration) runtime.Object {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "talos-system",
+				Labels:            map[string]string{constants.V1Alpha1PoolLabel: pool.Name},
+				Annotations:       map[string]string{constants.V1Alpha1NodeAnnotation: node},
+				CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+			},
+		}
+	}
+
+	clientset := fake.NewSimpleClientset(
+		log("worker-1-a", "worker-1", 3*time.Hour),
+		log("worker-1-b", "worker-1", 2*time.Hour),
+		log("worker-1-c", "worker-1", time.Hour),
+		log("worker-2-a", "worker-2", 4*time.Hour),
+	)
+
+	sink := ConfigMapLogSink{Client: clientset, Namespace: "talos-system", MaxAttempts: 2}
+
+	attempt := NewLogAttempt(pool, &poolv1alpha1.NodeStatus{Name: "worker-1"})
+
+	if err := sink.Append(context.Background(), attempt, []byte("installing\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := clientset.CoreV1().ConfigMaps("talos-system").List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+
+	for _, configMap := range list.Items {
+		got = append(got, configMap.Name)
+	}
+
+	want := []string{attempt.Name, "worker-1-c", "worker-2-a"}
+
+	sort.Strings(got)
+	sort.Strings(want)
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("logs = %v, want %v", got, want)
+	}
+}
+
+func TestSkipLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		n        int
+		want     string
+		wantLeft int
+	}{
+		{name: "none", data: "a\nb\n", want: "a\nb\n"},
+		{name: "some", data: "a\nb\nc\n", n: 2, want: "c\n"},
+		{name: "all", data: "a\nb\n", n: 2, want: ""},
+		{name: "more", data: "a\nb\n", n: 3, want: "", wantLeft: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, left := skipLines([]byte(tt.data), tt.n)
+			if string(got) != tt.want || left != tt.wantLeft {
+				t.Errorf("skipLines() = %q, %d, want %q, %d", got, left, tt.want, tt.wantLeft)
+			}
+		})
+	}
+}
+
+func TestLogCursor(t *testing.T) {
+	var c logCursor
+
+	if skip := c.connect(100); skip != 0 {
+		t.Errorf("first connection skips %d line(s), want 0", skip)
+	}
+
+	c.lines = 10
+
+	if skip := c.connect(100); skip != 10 {
+		t.Errorf("reconnection skips %d line(s), want 10", skip)
+	}
+
+	if skip := c.connect(200); skip != 0 {
+		t.Errorf("reconnection after a reboot skips %d line(s), want 0", skip)
+	}
+
+	c.lines = 5
+
+	if skip := c.connect(0); skip != 0 {
+		t.Errorf("reconnection with an unknown boot time skips %d line(s), want 0", skip)
+	}
+}
@@ -0,0 +1,123 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upgrader
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// AddressFamilyEnvVar is the preferred family of the node addresses, one
+	// of IPv4, IPv6 or DualStack.
+	AddressFamilyEnvVar = "TALOS_ADDRESS_FAMILY"
+	// AddressFallbackEnvVar is a comma separated list of the address types
+	// used if a node has no internal IP of either family, in order. The types
+	// are ExternalIP and Hostname.
+	AddressFallbackEnvVar = "TALOS_ADDRESS_FALLBACK"
+)
+
+const (
+	// IPv4 prefers IPv4 addresses.
+	IPv4 = "IPv4"
+	// IPv6 prefers IPv6 addresses.
+	IPv6 = "IPv6"
+	// DualStack uses the first address of either family.
+	DualStack = "DualStack"
+)
+
+// AddressError is returned when a node has no usable address.
+type AddressError struct {
+	node string
+}
+
+// NewAddressError returns an error for the node without a usable address.
+func NewAddressError(node string) AddressError {
+	return AddressError{node: node}
+}
+
+func (e AddressError) Error() string {
+	return fmt.Sprintf("node %q has no usable address", e.node)
+}
+
+// AddressSelector selects the address the node is reached on. The first
+// internal IP of the preferred family is used, then the first internal IP of
+// the other family, and then the first address of the fallback types, again
+// preferring the family. The zero value selects the first internal IP of
+// either family.
+type AddressSelector struct {
+	Family   string
+	Fallback []corev1.NodeAddressType
+}
+
+// NewAddressSelector returns the selector set by the TALOS_ADDRESS_FAMILY and
+// TALOS_ADDRESS_FALLBACK env vars.
+func NewAddressSelector() (AddressSelector, error) {
+	s := AddressSelector{Family: os.Getenv(AddressFamilyEnvVar)}
+
+	switch s.Family {
+	case "", IPv4, IPv6, DualStack:
+	default:
+		return s, fmt.Errorf("invalid %s %q", AddressFamilyEnvVar, s.Family)
+	}
+
+	if fallback, ok := os.LookupEnv(AddressFallbackEnvVar); ok {
+		for _, t := range strings.Split(fallback, ",") {
+			switch addressType := corev1.NodeAddressType(strings.TrimSpace(t)); addressType {
+			case corev1.NodeExternalIP, corev1.NodeHostName:
+				s.Fallback = append(s.Fallback, addressType)
+			default:
+				return s, fmt.Errorf("invalid %s %q", AddressFallbackEnvVar, t)
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// Address returns the node's address, or an AddressError if it has none.
+func (s AddressSelector) Address(node corev1.Node) (string, error) {
+	for _, addressType := range append([]corev1.NodeAddressType{corev1.NodeInternalIP}, s.Fallback...) {
+		for _, preferred := range []bool{true, false} {
+			for _, a := range node.Status.Addresses {
+				if a.Type == addressType && s.usable(a, preferred) {
+					return a.Address, nil
+				}
+			}
+		}
+	}
+
+	return "", NewAddressError(node.Name)
+}
+
+// usable returns true if the address is of the preferred family, or of the
+// other family if preferred is false.
+func (s AddressSelector) usable(a corev1.NodeAddress, preferred bool) bool {
+	if a.Type == corev1.NodeHostName {
+		return a.Address != ""
+	}
+
+	ip := net.ParseIP(a.Address)
+	if ip == nil {
+		return false
+	}
+
+	if !preferred {
+		return true
+	}
+
+	switch s.Family {
+	case IPv4:
+		return ip.To4() != nil
+	case IPv6:
+		return ip.To4() == nil
+	default:
+		return true
+	}
+}
@@ -0,0 +1,92 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upgrader
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestAddressSelector(t *testing.T) {
+	dualStack := []corev1.NodeAddress{
+		{Type: corev1.NodeHostName, Address: "worker-1"},
+		{Type: corev1.NodeInternalIP, Address: "fd00::3"},
+		{Type: corev1.NodeInternalIP, Address: "10.5.0.3"},
+		{Type: corev1.NodeExternalIP, Address: "203.0.113.3"},
+	}
+
+	ipv4 := []corev1.NodeAddress{
+		{Type: corev1.NodeHostName, Address: "worker-1"},
+		{Type: corev1.NodeExternalIP, Address: "2001:db8::3"},
+		{Type: corev1.NodeInternalIP, Address: "10.5.0.3"},
+	}
+
+	external := []corev1.NodeAddress{
+		{Type: corev1.NodeHostName, Address: "worker-1"},
+		{Type: corev1.NodeExternalIP, Address: "203.0.113.3"},
+	}
+
+	tests := []struct {
+		name      string
+		selector  AddressSelector
+		addresses []corev1.NodeAddress
+		want      string
+		wantErr   bool
+	}{
+		{name: "dual stack", addresses: dualStack, want: "fd00::3"},
+		{name: "ipv4", selector: AddressSelector{Family: IPv4}, addresses: dualStack, want: "10.5.0.3"},
+		{name: "ipv6", selector: AddressSelector{Family: IPv6}, addresses: dualStack, want: "fd00::3"},
+		{name: "other family", selector: AddressSelector{Family: IPv6}, addresses: ipv4, want: "10.5.0.3"},
+		{
+			name:      "other family before fallback",
+			selector:  AddressSelector{Family: IPv6, Fallback: []corev1.NodeAddressType{corev1.NodeExternalIP}},
+			addresses: ipv4,
+			want:      "10.5.0.3",
+		},
+		{name: "no internal ip", addresses: external, wantErr: true},
+		{
+			name:      "external ip fallback",
+			selector:  AddressSelector{Fallback: []corev1.NodeAddressType{corev1.NodeExternalIP, corev1.NodeHostName}},
+			addresses: external,
+			want:      "203.0.113.3",
+		},
+		{
+			name:      "external ip of other family",
+			selector:  AddressSelector{Family: IPv6, Fallback: []corev1.NodeAddressType{corev1.NodeExternalIP, corev1.NodeHostName}},
+			addresses: external,
+			want:      "203.0.113.3",
+		},
+		{
+			name:      "hostname fallback",
+			selector:  AddressSelector{Family: IPv6, Fallback: []corev1.NodeAddressType{corev1.NodeExternalIP, corev1.NodeHostName}},
+			addresses: external[:1],
+			want:      "worker-1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newNode("worker-1", false)
+			node.Status.Addresses = tt.addresses
+
+			got, err := tt.selector.Address(node)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Address() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				if _, ok := err.(AddressError); !ok {
+					t.Errorf("Address() error = %v, want AddressError", err)
+				}
+
+				return
+			}
+
+			if got != tt.want {
+				t.Errorf("Address() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
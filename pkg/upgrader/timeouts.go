@@ -0,0 +1,84 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upgrader
+
+import (
+	"fmt"
+	"time"
+
+	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// DefaultRequestTimeout bounds each request made to the Talos API.
+	DefaultRequestTimeout = 30 * time.Second
+	// DefaultRebootTimeout bounds the time the node may be unreachable while
+	// it reboots.
+	DefaultRebootTimeout = 10 * time.Minute
+	// DefaultVersionConvergenceTimeout bounds the time between requesting an
+	// upgrade and the node reporting the target version.
+	DefaultVersionConvergenceTimeout = 15 * time.Minute
+	// DefaultStabilityWindow is how long the node must stay healthy before
+	// the upgrade is considered successful.
+	DefaultStabilityWindow = 30 * time.Second
+
+	// healthyTimeout is the default timeout of each health check.
+	healthyTimeout = 15 * time.Minute
+)
+
+// Timeouts bounds each phase of a node's upgrade.
+type Timeouts struct {
+	Request            time.Duration
+	Reboot             time.Duration
+	VersionConvergence time.Duration
+	Stability          time.Duration
+}
+
+// NewTimeouts returns the pool's timeouts, with defaults for those that are
+// unset.
+func NewTimeouts(spec *poolv1alpha1.Timeouts) (Timeouts, error) {
+	t := Timeouts{
+		Request:            DefaultRequestTimeout,
+		Reboot:             DefaultRebootTimeout,
+		VersionConvergence: DefaultVersionConvergenceTimeout,
+		Stability:          DefaultStabilityWindow,
+	}
+
+	if spec == nil {
+		return t, nil
+	}
+
+	for _, d := range []struct {
+		name  string
+		spec  *metav1.Duration
+		value *time.Duration
+	}{
+		{"request", spec.Request, &t.Request},
+		{"reboot", spec.Reboot, &t.Reboot},
+		{"versionConvergence", spec.VersionConvergence, &t.VersionConvergence},
+		{"stability", spec.Stability, &t.Stability},
+	} {
+		if d.spec == nil {
+			continue
+		}
+
+		if d.spec.Duration <= 0 {
+			return t, fmt.Errorf("%s timeout must be positive, got %s", d.name, d.spec.Duration)
+		}
+
+		*d.value = d.spec.Duration
+	}
+
+	if t.Request > t.Reboot {
+		return t, fmt.Errorf("request timeout (%s) must not exceed the reboot timeout (%s)", t.Request, t.Reboot)
+	}
+
+	if t.Reboot > t.VersionConvergence {
+		return t, fmt.Errorf("reboot timeout (%s) must not exceed the version convergence timeout (%s)", t.Reboot, t.VersionConvergence)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,56 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upgrader
+
+import (
+	"testing"
+	"time"
+
+	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewTimeouts(t *testing.T) {
+	d := func(d time.Duration) *metav1.Duration { return &metav1.Duration{Duration: d} }
+
+	tests := []struct {
+		name    string
+		spec    *poolv1alpha1.Timeouts
+		want    Timeouts
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			want: Timeouts{DefaultRequestTimeout, DefaultRebootTimeout, DefaultVersionConvergenceTimeout, DefaultStabilityWindow},
+		},
+		{
+			name: "overrides",
+			spec: &poolv1alpha1.Timeouts{Reboot: d(30 * time.Minute), VersionConvergence: d(45 * time.Minute)},
+			want: Timeouts{DefaultRequestTimeout, 30 * time.Minute, 45 * time.Minute, DefaultStabilityWindow},
+		},
+		{
+			name:    "negative",
+			spec:    &poolv1alpha1.Timeouts{Stability: d(-time.Second)},
+			wantErr: true,
+		},
+		{
+			name:    "reboot exceeds convergence",
+			spec:    &poolv1alpha1.Timeouts{Reboot: d(time.Hour)},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewTimeouts(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewTimeouts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("NewTimeouts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upgrader
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"strconv"
+
+	"github.com/hashicorp/go-multierror"
+	talosx509 "github.com/talos-systems/crypto/x509"
+	securityapi "github.com/talos-systems/talos/pkg/machinery/api/security"
+	talosconstants "github.com/talos-systems/talos/pkg/machinery/constants"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// TrustdGenerator signs certificates with trustd on the endpoints,
+// authenticating with the token.
+type TrustdGenerator struct {
+	Token     string
+	Endpoints []string
+}
+
+// Identity implements the talostls.Generator interface. The endpoints are
+// tried in order until one signs the CSR.
+func (g TrustdGenerator) Identity(csr *talosx509.CertificateSigningRequest) (ca, crt []byte, err error) {
+	var result *multierror.Error
+
+	for _, endpoint := range g.Endpoints {
+		if ca, crt, err = g.sign(endpoint, csr); err == nil {
+			return ca, crt, nil
+		}
+
+		result = multierror.Append(result, err)
+	}
+
+	return nil, nil, result.ErrorOrNil()
+}
+
+func (g TrustdGenerator) sign(endpoint string, csr *talosx509.CertificateSigningRequest) (ca, crt []byte, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultRequestTimeout)
+	defer cancel()
+
+	// trustd's certificate can not be verified before its CA is known.
+	conn, err := grpc.DialContext(ctx, net.JoinHostPort(endpoint, strconv.Itoa(talosconstants.TrustdPort)),
+		// nolint: gosec
+		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{InsecureSkipVerify: true})),
+		grpc.WithPerRPCCredentials(tokenCredentials(g.Token)),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// nolint: errcheck
+	defer conn.Close()
+
+	resp, err := securityapi.NewSecurityServiceClient(conn).Certificate(ctx, &securityapi.CertificateRequest{Csr: csr.X509CertificateRequestPEM})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return resp.Ca, resp.Crt, nil
+}
+
+// tokenCredentials authenticates requests to trustd with the token.
+type tokenCredentials string
+
+// GetRequestMetadata implements the credentials.PerRPCCredentials interface.
+func (t tokenCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"token": string(t)}, nil
+}
+
+// RequireTransportSecurity implements the credentials.PerRPCCredentials
+// interface.
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return true
+}
@@ -0,0 +1,92 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upgrader
+
+import (
+	"fmt"
+
+	"github.com/blang/semver"
+	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
+	machineapi "github.com/talos-systems/talos/pkg/machinery/api/machine"
+)
+
+// The Talos versions that added the upgrade options to the machine API.
+var (
+	preserveVersion = semver.MustParse("0.5.0")
+	stageVersion    = semver.MustParse("0.8.0")
+	forceVersion    = semver.MustParse("0.9.0")
+)
+
+// UnsupportedOptionError is returned when a node can not be upgraded with
+// the pool's upgrade options.
+type UnsupportedOptionError struct {
+	option string
+	reason string
+}
+
+func NewUnsupportedOptionError(option, reason string) UnsupportedOptionError {
+	return UnsupportedOptionError{option, reason}
+}
+
+func (u UnsupportedOptionError) Error() string {
+	return fmt.Sprintf("upgrade option %s is not supported: %s", u.option, u.reason)
+}
+
+// checkUpgradeOptions returns an UnsupportedOptionError if the options can
+// not be sent to a node running the Talos version.
+func checkUpgradeOptions(opts *poolv1alpha1.UpgradeOptions, tag string) error {
+	if opts == nil {
+		return nil
+	}
+
+	switch opts.RebootMode {
+	case "", poolv1alpha1.DefaultRebootMode:
+	default:
+		return NewUnsupportedOptionError("rebootMode", fmt.Sprintf("unknown reboot mode %q", opts.RebootMode))
+	}
+
+	options := []struct {
+		name    string
+		set     bool
+		version semver.Version
+	}{
+		{"preserve", opts.Preserve, preserveVersion},
+		{"stage", opts.Stage, stageVersion},
+		{"force", opts.Force, forceVersion},
+	}
+
+	for _, o := range options {
+		if !o.set {
+			continue
+		}
+
+		v, err := semver.ParseTolerant(tag)
+		if err != nil {
+			return NewUnsupportedOptionError(o.name, fmt.Sprintf("unable to parse the node's Talos version %q", tag))
+		}
+
+		// Pre-releases of the version that added an option support it.
+		v.Pre = nil
+
+		if v.LT(o.version) {
+			return NewUnsupportedOptionError(o.name, fmt.Sprintf("the node runs Talos %s, and v%s or later is required", tag, o.version))
+		}
+	}
+
+	return nil
+}
+
+// upgradeRequest returns the upgrade request for the image with the options.
+func upgradeRequest(image string, opts *poolv1alpha1.UpgradeOptions) *machineapi.UpgradeRequest {
+	req := &machineapi.UpgradeRequest{Image: image}
+
+	if opts != nil {
+		req.Preserve = opts.Preserve
+		req.Stage = opts.Stage
+		req.Force = opts.Force
+	}
+
+	return req
+}
@@ -0,0 +1,76 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upgrader
+
+import (
+	"testing"
+
+	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
+)
+
+func TestUpgradeRequest(t *testing.T) {
+	tests := []struct {
+		name                   string
+		opts                   *poolv1alpha1.UpgradeOptions
+		preserve, stage, force bool
+	}{
+		{name: "none"},
+		{name: "defaults", opts: &poolv1alpha1.UpgradeOptions{RebootMode: poolv1alpha1.DefaultRebootMode}},
+		{
+			name:     "all",
+			opts:     &poolv1alpha1.UpgradeOptions{Preserve: true, Stage: true, Force: true},
+			preserve: true,
+			stage:    true,
+			force:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := upgradeRequest("installer", tt.opts)
+
+			if req.Image != "installer" {
+				t.Errorf("upgradeRequest() image = %q, want %q", req.Image, "installer")
+			}
+
+			if req.Preserve != tt.preserve || req.Stage != tt.stage || req.Force != tt.force {
+				t.Errorf("upgradeRequest() = preserve %v, stage %v, force %v, want %v, %v, %v", req.Preserve, req.Stage, req.Force, tt.preserve, tt.stage, tt.force)
+			}
+		})
+	}
+}
+
+func TestCheckUpgradeOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    *poolv1alpha1.UpgradeOptions
+		tag     string
+		wantErr bool
+	}{
+		{name: "none", tag: "v0.4.0"},
+		{name: "no options on an unparsable version", opts: &poolv1alpha1.UpgradeOptions{}, tag: "abcdef"},
+		{name: "preserve", opts: &poolv1alpha1.UpgradeOptions{Preserve: true}, tag: "v0.5.1"},
+		{name: "preserve on an old version", opts: &poolv1alpha1.UpgradeOptions{Preserve: true}, tag: "v0.4.1", wantErr: true},
+		{name: "stage", opts: &poolv1alpha1.UpgradeOptions{Stage: true}, tag: "v0.8.0"},
+		{name: "stage on an old version", opts: &poolv1alpha1.UpgradeOptions{Stage: true}, tag: "v0.7.1", wantErr: true},
+		{name: "force on a pre-release", opts: &poolv1alpha1.UpgradeOptions{Force: true}, tag: "v0.9.0-alpha.1"},
+		{name: "force on an old version", opts: &poolv1alpha1.UpgradeOptions{Force: true}, tag: "v0.8.4", wantErr: true},
+		{name: "force on an unparsable version", opts: &poolv1alpha1.UpgradeOptions{Force: true}, tag: "abcdef", wantErr: true},
+		{name: "default reboot mode", opts: &poolv1alpha1.UpgradeOptions{RebootMode: poolv1alpha1.DefaultRebootMode}, tag: "v0.9.0"},
+		{name: "unknown reboot mode", opts: &poolv1alpha1.UpgradeOptions{RebootMode: "PowerCycle"}, tag: "v0.9.0", wantErr: true},
+		{name: "invalid reboot mode", opts: &poolv1alpha1.UpgradeOptions{RebootMode: "Halt"}, tag: "v0.9.0", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkUpgradeOptions(tt.opts, tt.tag)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkUpgradeOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if _, ok := err.(UnsupportedOptionError); tt.wantErr && !ok {
+				t.Errorf("checkUpgradeOptions() error = %T, want UnsupportedOptionError", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upgrader
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	machineapi "github.com/talos-systems/talos/pkg/machinery/api/machine"
+	"github.com/talos-systems/talos/pkg/machinery/client"
+	talosconstants "github.com/talos-systems/talos/pkg/machinery/constants"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// LeaderMover moves etcd leadership off a node.
+type LeaderMover interface {
+	MoveLeader(context.Context, corev1.Node) error
+}
+
+// QuorumError is returned when upgrading a control plane node could lose etcd
+// quorum.
+type QuorumError struct {
+	node   string
+	reason string
+}
+
+func NewQuorumError(node, reason string) QuorumError {
+	return QuorumError{node, reason}
+}
+
+func (q QuorumError) Error() string {
+	return fmt.Sprintf("refusing to upgrade control plane node %s: %s", q.node, q.reason)
+}
+
+// EtcdQuorumPolicy protects etcd quorum while upgrading control plane nodes.
+// The candidates are selected by the fallback policy. A control plane node
+// that it selects is only started alone, when no other upgrade is in
+// progress and every etcd member is healthy.
+type EtcdQuorumPolicy struct {
+	Fallback UpgradePolicy
+	// Etcd checks the health of every etcd member.
+	Etcd HealthCheck
+	// Timeout bounds the health check.
+	Timeout time.Duration
+	// LeaderMover, if set, moves etcd leadership off a control plane node
+	// before it is selected.
+	LeaderMover LeaderMover
+}
+
+func (policy EtcdQuorumPolicy) Select(ctx context.Context, candidates []corev1.Node, inProgress int) ([]corev1.Node, error) {
+	var others []corev1.Node
+
+	for _, node := range candidates {
+		if !IsControlPlane(node) {
+			others = append(others, node)
+		}
+	}
+
+	if inProgress > 0 {
+		return policy.Fallback.Select(ctx, others, inProgress)
+	}
+
+	selected, err := policy.Fallback.Select(ctx, candidates, inProgress)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, node := range selected {
+		if !IsControlPlane(node) {
+			continue
+		}
+
+		if err := check(ctx, policy.Timeout, policy.Etcd, node); err != nil {
+			return nil, NewQuorumError(node.Name, err.Error())
+		}
+
+		if policy.LeaderMover != nil {
+			if err := policy.LeaderMover.MoveLeader(ctx, node); err != nil {
+				return nil, NewQuorumError(node.Name, fmt.Sprintf("failed to move etcd leadership: %v", err))
+			}
+		}
+
+		return []corev1.Node{node}, nil
+	}
+
+	return selected, nil
+}
+
+// IsControlPlane returns true if the node is an etcd member.
+func IsControlPlane(node corev1.Node) bool {
+	for _, label := range []string{talosconstants.LabelNodeRoleMaster, talosconstants.LabelNodeRoleControlPlane} {
+		if _, ok := node.Labels[label]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// EtcdLeaderMover moves etcd leadership off a control plane node with the
+// Talos API.
+type EtcdLeaderMover struct {
+	Talos *TalosClient
+}
+
+// MoveLeader implements the LeaderMover interface.
+func (m EtcdLeaderMover) MoveLeader(ctx context.Context, node corev1.Node) error {
+	return m.Talos.Do(ctx, node, func(ctx context.Context, c machineapi.MachineServiceClient) error {
+		_, err := client.FilterMessages(c.EtcdForfeitLeadership(ctx, &machineapi.EtcdForfeitLeadershipRequest{}))
+
+		return err
+	})
+}
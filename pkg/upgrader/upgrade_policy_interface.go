@@ -5,10 +5,34 @@
 package upgrader
 
 import (
+	"context"
+	"fmt"
+	"time"
+
 	corev1 "k8s.io/api/core/v1"
-	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 type UpgradePolicy interface {
-	Run(reconcile.Request, corev1.NodeList, string) error
+	// Select returns the candidates that may start upgrading, given the
+	// number of upgrades already in progress.
+	Select(context.Context, []corev1.Node, int) ([]corev1.Node, error)
+}
+
+// WaitError is returned by a policy that will not select any candidates
+// until the duration has passed.
+type WaitError struct {
+	after time.Duration
+}
+
+func NewWaitError(d time.Duration) WaitError {
+	return WaitError{d}
+}
+
+func (w WaitError) Error() string {
+	return fmt.Sprintf("waiting %s before selecting nodes", w.after)
+}
+
+// After returns how long to wait.
+func (w WaitError) After() time.Duration {
+	return w.after
 }
@@ -0,0 +1,96 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upgrader
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// PolicyOptions is the state of the pool that a policy is built for.
+type PolicyOptions struct {
+	Pool *poolv1alpha1.Pool
+	// Nodes and Statuses are every node in the pool, and their upgrade
+	// state. Statuses are updated as nodes are selected.
+	Nodes    []corev1.Node
+	Statuses map[string]*poolv1alpha1.NodeStatus
+}
+
+// PolicyFactory builds an upgrade policy for the pool.
+type PolicyFactory func(PolicyOptions) (UpgradePolicy, error)
+
+var (
+	policies   = map[string]PolicyFactory{}
+	policiesMu sync.Mutex
+)
+
+func init() {
+	RegisterPolicy(poolv1alpha1.SerialStrategy, func(opts PolicyOptions) (UpgradePolicy, error) {
+		return SerialPolicy{}, nil
+	})
+
+	RegisterPolicy(poolv1alpha1.ConcurrentStrategy, func(opts PolicyOptions) (UpgradePolicy, error) {
+		return NewConcurrentPolicy(opts.Pool.Spec.Concurrency), nil
+	})
+
+	RegisterPolicy(poolv1alpha1.TopologyStrategy, func(opts PolicyOptions) (UpgradePolicy, error) {
+		topology := opts.Pool.Spec.Topology
+		if topology == nil || topology.Key == "" {
+			return nil, errors.New("the Topology strategy requires a topology key")
+		}
+
+		policy := TopologyPolicy{
+			Fallback: NewConcurrentPolicy(opts.Pool.Spec.Concurrency),
+			Key:      topology.Key,
+			Nodes:    opts.Nodes,
+			Statuses: opts.Statuses,
+		}
+
+		if topology.Pause != nil {
+			policy.Pause = topology.Pause.Duration
+		}
+
+		return policy, nil
+	})
+}
+
+// RegisterPolicy makes a policy available to pools by its strategy name,
+// replacing any policy registered under the same name. Controllers that embed
+// the reconciler can register their own policies before starting it.
+func RegisterPolicy(strategy string, factory PolicyFactory) {
+	policiesMu.Lock()
+	defer policiesMu.Unlock()
+
+	policies[strategy] = factory
+}
+
+// NewPolicy builds the policy registered for the pool's strategy. Pools
+// without a strategy use the Topology strategy if they have a topology, and
+// the Concurrent strategy otherwise.
+func NewPolicy(opts PolicyOptions) (UpgradePolicy, error) {
+	strategy := opts.Pool.Spec.Strategy
+
+	if strategy == "" {
+		strategy = poolv1alpha1.ConcurrentStrategy
+
+		if opts.Pool.Spec.Topology != nil {
+			strategy = poolv1alpha1.TopologyStrategy
+		}
+	}
+
+	policiesMu.Lock()
+	factory, ok := policies[strategy]
+	policiesMu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy %q", strategy)
+	}
+
+	return factory(opts)
+}
@@ -5,20 +5,17 @@
 package upgrader
 
 import (
+	"context"
+
 	corev1 "k8s.io/api/core/v1"
-	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
-type SerialPolicy struct {
-	Upgrader
-}
+type SerialPolicy struct{}
 
-func (policy SerialPolicy) Run(req reconcile.Request, nodes corev1.NodeList, version string, inProgress bool) error {
-	for _, node := range nodes.Items {
-		if err := policy.Upgrade(req, node, version, inProgress); err != nil {
-			return err
-		}
+func (policy SerialPolicy) Select(ctx context.Context, candidates []corev1.Node, inProgress int) ([]corev1.Node, error) {
+	if inProgress > 0 || len(candidates) == 0 {
+		return nil, nil
 	}
 
-	return nil
+	return candidates[:1], nil
 }
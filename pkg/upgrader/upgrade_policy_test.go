@@ -0,0 +1,321 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upgrader
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
+	talosconstants "github.com/talos-systems/talos/pkg/machinery/constants"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type fakeCheck struct {
+	err error
+}
+
+func (check fakeCheck) Name() string {
+	return "Fake"
+}
+
+func (check fakeCheck) Check(ctx context.Context, node corev1.Node) error {
+	return check.err
+}
+
+func newNode(name string, controlPlane bool) corev1.Node {
+	node := corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{}}}
+
+	if controlPlane {
+		node.Labels[talosconstants.LabelNodeRoleMaster] = ""
+	}
+
+	return node
+}
+
+// waitPolicy is a fallback policy that holds back every node.
+type waitPolicy struct{}
+
+func (waitPolicy) Select(context.Context, []corev1.Node, int) ([]corev1.Node, error) {
+	return nil, NewWaitError(time.Minute)
+}
+
+// fakeLeaderMover records the nodes that leadership was moved off.
+type fakeLeaderMover struct {
+	err   error
+	moved []string
+}
+
+func (m *fakeLeaderMover) MoveLeader(ctx context.Context, node corev1.Node) error {
+	m.moved = append(m.moved, node.Name)
+
+	return m.err
+}
+
+func names(nodes []corev1.Node) (n []string) {
+	for _, node := range nodes {
+		n = append(n, node.Name)
+	}
+
+	return n
+}
+
+func TestEtcdQuorumPolicy(t *testing.T) {
+	candidates := []corev1.Node{newNode("worker-1", false), newNode("master-1", true), newNode("master-2", true), newNode("worker-2", false)}
+
+	controlPlane := newNode("cp-1", false)
+	controlPlane.Labels[talosconstants.LabelNodeRoleControlPlane] = ""
+
+	tests := []struct {
+		name       string
+		candidates []corev1.Node
+		inProgress int
+		fallback   UpgradePolicy
+		etcd       error
+		mover      *fakeLeaderMover
+		want       []string
+		wantMoved  []string
+		wantErr    bool
+		wantWait   bool
+	}{
+		{
+			name:       "one control plane node at a time",
+			candidates: candidates,
+			want:       []string{"master-1"},
+		},
+		{
+			name:       "control plane waits for upgrades in progress",
+			candidates: candidates,
+			inProgress: 1,
+			want:       []string{"worker-1", "worker-2"},
+		},
+		{
+			name:       "unhealthy etcd",
+			candidates: candidates,
+			etcd:       errors.New("1 of 3 etcd members are healthy"),
+			wantErr:    true,
+		},
+		{
+			name:       "workers only",
+			candidates: []corev1.Node{newNode("worker-1", false), newNode("worker-2", false), newNode("worker-3", false)},
+			etcd:       errors.New("unreachable"),
+			want:       []string{"worker-1", "worker-2", "worker-3"},
+		},
+		{
+			name:       "fallback order",
+			candidates: candidates,
+			fallback:   NewConcurrentPolicy(1),
+			etcd:       errors.New("unreachable"),
+			want:       []string{"worker-1"},
+		},
+		{
+			name:       "fallback waiting",
+			candidates: candidates,
+			fallback:   waitPolicy{},
+			wantErr:    true,
+			wantWait:   true,
+		},
+		{
+			name:       "control-plane role",
+			candidates: []corev1.Node{controlPlane, newNode("worker-1", false)},
+			want:       []string{"cp-1"},
+		},
+		{
+			name:       "leadership moved",
+			candidates: candidates,
+			mover:      &fakeLeaderMover{},
+			want:       []string{"master-1"},
+			wantMoved:  []string{"master-1"},
+		},
+		{
+			name:       "leadership not moved",
+			candidates: candidates,
+			mover:      &fakeLeaderMover{err: errors.New("not a member")},
+			wantMoved:  []string{"master-1"},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fallback := tt.fallback
+			if fallback == nil {
+				fallback = NewConcurrentPolicy(3)
+			}
+
+			policy := EtcdQuorumPolicy{
+				Fallback: fallback,
+				Etcd:     fakeCheck{tt.etcd},
+				Timeout:  time.Second,
+			}
+
+			if tt.mover != nil {
+				policy.LeaderMover = tt.mover
+			}
+
+			got, err := policy.Select(context.Background(), tt.candidates, tt.inProgress)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Select() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if _, ok := err.(WaitError); ok != tt.wantWait {
+				t.Errorf("Select() error = %v, wantWait %v", err, tt.wantWait)
+			}
+
+			if !reflect.DeepEqual(names(got), tt.want) {
+				t.Errorf("Select() = %v, want %v", names(got), tt.want)
+			}
+
+			if tt.mover != nil && !reflect.DeepEqual(tt.mover.moved, tt.wantMoved) {
+				t.Errorf("Select() moved leadership off %v, want %v", tt.mover.moved, tt.wantMoved)
+			}
+		})
+	}
+}
+
+func TestTopologyPolicy(t *testing.T) {
+	zoned := func(name, zone string) corev1.Node {
+		node := newNode(name, false)
+		if zone != "" {
+			node.Labels["zone"] = zone
+		}
+
+		return node
+	}
+
+	nodes := []corev1.Node{zoned("b-1", "b"), zoned("a-1", "a"), zoned("none-1", ""), zoned("a-2", "a"), zoned("b-2", "b")}
+
+	status := func(phase string, ago time.Duration) *poolv1alpha1.NodeStatus {
+		return &poolv1alpha1.NodeStatus{Phase: phase, LastTransitionTime: metav1.NewTime(time.Now().Add(-ago))}
+	}
+
+	tests := []struct {
+		name       string
+		statuses   map[string]*poolv1alpha1.NodeStatus
+		inProgress int
+		want       []string
+		wantWait   bool
+	}{
+		{
+			name: "first group",
+			want: []string{"a-1", "a-2"},
+		},
+		{
+			name:       "group in progress",
+			statuses:   map[string]*poolv1alpha1.NodeStatus{"b-1": status(poolv1alpha1.NodeUpgrading, 0)},
+			inProgress: 1,
+			want:       []string{"b-2"},
+		},
+		{
+			name:     "pause between groups",
+			statuses: map[string]*poolv1alpha1.NodeStatus{"a-1": status(poolv1alpha1.NodeSucceeded, time.Minute), "a-2": status(poolv1alpha1.NodeSucceeded, time.Minute)},
+			wantWait: true,
+		},
+		{
+			name:     "pause elapsed",
+			statuses: map[string]*poolv1alpha1.NodeStatus{"a-1": status(poolv1alpha1.NodeSucceeded, time.Hour), "a-2": status(poolv1alpha1.NodeFailed, time.Hour)},
+			want:     []string{"b-1", "b-2"},
+		},
+		{
+			name:     "unlabeled last",
+			statuses: map[string]*poolv1alpha1.NodeStatus{"a-1": status(poolv1alpha1.NodeSucceeded, time.Hour), "a-2": status(poolv1alpha1.NodeSucceeded, time.Hour), "b-1": status(poolv1alpha1.NodeSucceeded, time.Hour), "b-2": status(poolv1alpha1.NodeSucceeded, time.Hour)},
+			want:     []string{"none-1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statuses := map[string]*poolv1alpha1.NodeStatus{}
+
+			var candidates []corev1.Node
+
+			for _, node := range nodes {
+				s, ok := tt.statuses[node.Name]
+				if !ok {
+					s = &poolv1alpha1.NodeStatus{}
+
+					candidates = append(candidates, node)
+				}
+
+				statuses[node.Name] = s
+			}
+
+			policy := TopologyPolicy{
+				Fallback: NewConcurrentPolicy(3),
+				Key:      "zone",
+				Pause:    10 * time.Minute,
+				Nodes:    nodes,
+				Statuses: statuses,
+			}
+
+			got, err := policy.Select(context.Background(), candidates, tt.inProgress)
+			if _, ok := err.(WaitError); ok != tt.wantWait {
+				t.Fatalf("Select() error = %v, wantWait %v", err, tt.wantWait)
+			}
+
+			if !reflect.DeepEqual(names(got), tt.want) {
+				t.Errorf("Select() = %v, want %v", names(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPolicy(t *testing.T) {
+	RegisterPolicy("Custom", func(opts PolicyOptions) (UpgradePolicy, error) {
+		return SerialPolicy{}, nil
+	})
+
+	tests := []struct {
+		name    string
+		spec    poolv1alpha1.PoolSpec
+		want    UpgradePolicy
+		wantErr bool
+	}{
+		{
+			name: "default",
+			spec: poolv1alpha1.PoolSpec{Concurrency: 2},
+			want: ConcurrentPolicy{Concurrency: 2},
+		},
+		{
+			name: "serial",
+			spec: poolv1alpha1.PoolSpec{Strategy: poolv1alpha1.SerialStrategy, Concurrency: 2},
+			want: SerialPolicy{},
+		},
+		{
+			name: "default with topology",
+			spec: poolv1alpha1.PoolSpec{Topology: &poolv1alpha1.Topology{Key: "zone"}},
+			want: TopologyPolicy{Fallback: ConcurrentPolicy{Concurrency: 1}, Key: "zone"},
+		},
+		{
+			name:    "topology without key",
+			spec:    poolv1alpha1.PoolSpec{Strategy: poolv1alpha1.TopologyStrategy},
+			wantErr: true,
+		},
+		{
+			name: "custom",
+			spec: poolv1alpha1.PoolSpec{Strategy: "Custom"},
+			want: SerialPolicy{},
+		},
+		{
+			name:    "unknown",
+			spec:    poolv1alpha1.PoolSpec{Strategy: "Canary"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewPolicy(PolicyOptions{Pool: &poolv1alpha1.Pool{Spec: tt.spec}})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewPolicy() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upgrader
+
+import (
+	"context"
+	"time"
+
+	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// TopologyPolicy groups nodes by the value of a label, and only selects
+// candidates from one group at a time. A group is finished before the next
+// is started, in the order of the label's values, so that a rollout never
+// spans failure domains. Candidates within a group are selected by the
+// fallback policy.
+type TopologyPolicy struct {
+	Fallback UpgradePolicy
+	// Key is the label that nodes are grouped by.
+	Key string
+	// Pause is how long to wait after a group finishes before starting the
+	// next.
+	Pause time.Duration
+	// Nodes and Statuses are every node in the pool, and their upgrade
+	// state.
+	Nodes    []corev1.Node
+	Statuses map[string]*poolv1alpha1.NodeStatus
+}
+
+func (policy TopologyPolicy) Select(ctx context.Context, candidates []corev1.Node, inProgress int) ([]corev1.Node, error) {
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	var (
+		active   string
+		found    bool
+		finished string
+		last     time.Time
+	)
+
+	for _, node := range policy.Nodes {
+		s, ok := policy.Statuses[node.Name]
+		if !ok {
+			continue
+		}
+
+		switch {
+		case s.InProgress():
+			active, found = policy.group(node), true
+		case s.Phase != "" && s.LastTransitionTime.After(last):
+			finished, last = policy.group(node), s.LastTransitionTime.Time
+		}
+	}
+
+	if !found {
+		active = policy.group(candidates[0])
+
+		for _, node := range candidates[1:] {
+			if g := policy.group(node); before(g, active) {
+				active = g
+			}
+		}
+
+		if !last.IsZero() && active != finished {
+			if wait := policy.Pause - time.Since(last); wait > 0 {
+				return nil, NewWaitError(wait)
+			}
+		}
+	}
+
+	var group []corev1.Node
+
+	for _, node := range candidates {
+		if policy.group(node) == active {
+			group = append(group, node)
+		}
+	}
+
+	return policy.Fallback.Select(ctx, group, inProgress)
+}
+
+func (policy TopologyPolicy) group(node corev1.Node) string {
+	return node.Labels[policy.Key]
+}
+
+// before orders groups by value, with nodes that are not labeled last.
+func before(a, b string) bool {
+	if a == "" || b == "" {
+		return b == "" && a != ""
+	}
+
+	return a < b
+}
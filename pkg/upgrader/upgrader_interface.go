@@ -5,10 +5,15 @@
 package upgrader
 
 import (
+	"context"
+
 	corev1 "k8s.io/api/core/v1"
-	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
 )
 
 type Upgrader interface {
-	Upgrade(reconcile.Request, corev1.Node, string, bool) error
+	// Step advances the node's upgrade by one phase, recording the result in
+	// the node's status.
+	Step(context.Context, *poolv1alpha1.Pool, corev1.Node, *poolv1alpha1.NodeStatus) error
 }
@@ -5,44 +5,55 @@
 package upgrader
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"fmt"
 	"io"
-	"net"
 	"os"
-	"strings"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
+	digest "github.com/opencontainers/go-digest"
 	"github.com/pkg/errors"
 	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
+	"github.com/talos-systems/talos-controller-manager/pkg/constants"
+	"github.com/talos-systems/talos-controller-manager/pkg/registry"
+	"github.com/talos-systems/talos-controller-manager/pkg/tracing"
 
-	"github.com/talos-systems/talos/api/common"
-	machineapi "github.com/talos-systems/talos/api/machine"
-	"github.com/talos-systems/talos/cmd/osctl/pkg/client"
-	talosconstants "github.com/talos-systems/talos/pkg/constants"
-	"github.com/talos-systems/talos/pkg/grpc/tls"
-	taloskubernetes "github.com/talos-systems/talos/pkg/kubernetes"
-	"github.com/talos-systems/talos/pkg/retry"
+	"github.com/talos-systems/talos/pkg/machinery/api/common"
+	machineapi "github.com/talos-systems/talos/pkg/machinery/api/machine"
+	"github.com/talos-systems/talos/pkg/machinery/client"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
 	corev1 "k8s.io/api/core/v1"
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
 	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
+// logReconnectInterval is how long to wait before reconnecting to a node's
+// log stream, such as while it reboots.
+const logReconnectInterval = 5 * time.Second
+
 type V1Alpha1 struct {
 	log         logr.Logger
 	ctrlclient  ctrlclient.Client
-	talosclient *client.Client
-	kubeclient  *taloskubernetes.Client
+	talosclient *TalosClient
+	kubeclient  kubernetes.Interface
+	hooks       HookJob
+	logs        LogSink
+
+	// streams cancels the log capture of each upgrading node, keyed by
+	// pool and node name.
+	mu      sync.Mutex
+	streams map[string]context.CancelFunc
 }
 
 func NewV1Alpha1(ctrlclient ctrlclient.Client) (v *V1Alpha1, err error) {
@@ -53,57 +64,46 @@ func NewV1Alpha1(ctrlclient ctrlclient.Client) (v *V1Alpha1, err error) {
 		return nil, err
 	}
 
-	kubeclient, err := taloskubernetes.NewForConfig(config)
+	kubeclient, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create client: %w", err)
 	}
 
-	var endpoints []string
-
-	endpoints, err = kubeclient.MasterIPs()
+	addresses, err := NewAddressSelector()
 	if err != nil {
 		return nil, err
 	}
 
-	var (
-		token string
-		ok    bool
-	)
-
-	if token, ok = os.LookupEnv("TALOS_TOKEN"); !ok {
-		return nil, errors.New("TALOS_TOKEN env var is required")
+	source, err := NewEndpointsSource(kubeclient, addresses)
+	if err != nil {
+		return nil, err
 	}
 
-	hostname, err := os.Hostname()
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultRequestTimeout)
+	defer cancel()
+
+	endpoints, err := source.Endpoints(ctx)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to get Talos API endpoints: %w", err)
 	}
 
-	certificateProvider, err := tls.NewRemoteRenewingFileCertificateProvider(
-		token,
-		endpoints,
-		talosconstants.TrustdPort,
-		[]string{hostname},
-		[]net.IP{},
-	)
+	tlsConfig, err := NewTLSConfigFunc(endpoints)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to load credentials: %w", err)
 	}
 
-	ca, err := certificateProvider.GetCA()
+	talosclient, err := NewTalosClient(ctx, source, tlsConfig)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get root CA: %w", err)
+		return nil, err
 	}
 
-	creds, err := tls.New(
-		tls.WithClientAuthType(tls.Mutual),
-		tls.WithCACertPEM(ca),
-		tls.WithClientCertificateProvider(certificateProvider),
-	)
+	talosclient.Addresses = addresses
+	talosclient.Nodes = kubeclient
 
-	talosclient, err := client.NewClient(creds, endpoints, talosconstants.ApidPort)
-	if err != nil {
-		return nil, fmt.Errorf("error constructing client: %w", err)
+	if s, ok := os.LookupEnv(DirectEnvVar); ok {
+		if talosclient.Direct, err = strconv.ParseBool(s); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", DirectEnvVar, err)
+		}
 	}
 
 	v = &V1Alpha1{
@@ -111,238 +111,574 @@ func NewV1Alpha1(ctrlclient ctrlclient.Client) (v *V1Alpha1, err error) {
 		ctrlclient:  ctrlclient,
 		talosclient: talosclient,
 		kubeclient:  kubeclient,
+		hooks:       HookJob{Client: kubeclient},
+		logs:        ConfigMapLogSink{Client: kubeclient, Namespace: constants.DefaultNamespace},
+	}
+
+	if dir, ok := os.LookupEnv(LogDirEnvVar); ok {
+		v.logs = FileLogSink{Dir: dir}
 	}
 
 	return v, nil
 }
 
-func (v1alpha1 V1Alpha1) Upgrade(req reconcile.Request, node corev1.Node, tag string, inProgess bool) (err error) {
-	var pool poolv1alpha1.Pool
-	if err := v1alpha1.ctrlclient.Get(context.Background(), req.NamespacedName, &pool); err != nil {
-		if apierrors.IsNotFound(err) {
-			return nil
-		}
-
+// Step advances the node's upgrade by one phase, in the order Pending,
+// PreUpgrade, Upgrading, Verifying, PostUpgrade and Succeeded. The hook phases
+// are skipped if the pool does not define them. Each phase only checks the node's
+// current state and returns, so that reconciles are never blocked for the
+// duration of the upgrade. A phase that does not complete in time moves the
+// node to Failed.
+func (v1alpha1 *V1Alpha1) Step(ctx context.Context, pool *poolv1alpha1.Pool, node corev1.Node, nodeStatus *poolv1alpha1.NodeStatus) error {
+	t, err := NewTimeouts(pool.Spec.Timeouts)
+	if err != nil {
 		return err
 	}
 
-	if pool.Spec.Repository == "" {
-		return errors.New("a repository is required")
+	// The log is captured while the node is upgrading.
+	defer func() {
+		if nodeStatus.Phase != poolv1alpha1.NodeUpgrading {
+			v1alpha1.stopLogs(pool.Name, node.Name)
+		}
+	}()
+
+	if _, err = v1alpha1.talosclient.Addresses.Address(node); err != nil {
+		nodeStatus.Transition(poolv1alpha1.NodeFailed, err.Error())
+		nodeStatus.Reason = poolv1alpha1.NoAddressReason
+
+		return err
 	}
 
-	// TODO(andrewrynhard): This should be passed in.
-	image := fmt.Sprintf("docker.io/%s:%s", pool.Spec.Repository, tag)
+	switch nodeStatus.Phase {
+	case poolv1alpha1.NodePending:
+		return v1alpha1.checkVersion(ctx, t, pool, node, nodeStatus)
+	case poolv1alpha1.NodePreUpgrade:
+		if done, err := v1alpha1.runHook(pool, PreUpgradeHook, pool.Spec.PreUpgrade, nodeStatus); !done {
+			return err
+		}
 
-	// TODO(andrewrynhard): Ensure that we have found the internal address.
-	var target string
-	for _, addr := range node.Status.Addresses {
-		if addr.Type == corev1.NodeInternalIP {
-			target = addr.Address
+		return v1alpha1.requestUpgrade(ctx, t, pool, node, nodeStatus)
+	case poolv1alpha1.NodeUpgrading:
+		return v1alpha1.verifyUpgrade(ctx, t, node, nodeStatus)
+	case poolv1alpha1.NodeVerifying:
+		return v1alpha1.waitForHealthy(ctx, t, pool, node, nodeStatus)
+	case poolv1alpha1.NodePostUpgrade:
+		if done, err := v1alpha1.runHook(pool, PostUpgradeHook, pool.Spec.PostUpgrade, nodeStatus); !done {
+			return err
 		}
+
+		v1alpha1.succeed(node, nodeStatus)
 	}
 
-	// TODO(andrewrynhard): Request upgrade with context timeout.
-	ctx := client.WithNodes(context.Background(), target)
+	return nil
+}
+
+// checkVersion checks if the node needs to be upgraded.
+func (v1alpha1 *V1Alpha1) checkVersion(ctx context.Context, t Timeouts, pool *poolv1alpha1.Pool, node corev1.Node, nodeStatus *poolv1alpha1.NodeStatus) error {
+	tag := nodeStatus.TargetVersion
+
+	if _, err := InstallerImage(pool, tag); err != nil {
+		nodeStatus.Transition(poolv1alpha1.NodeFailed, err.Error())
 
-	version, err := v1alpha1.getVersion(ctx)
+		return err
+	}
+
+	version, err := v1alpha1.getVersion(ctx, t.Request, node)
 	if err != nil {
+		if expired(nodeStatus.LastTransitionTime, t.Reboot) {
+			nodeStatus.Transition(poolv1alpha1.NodeFailed, fmt.Sprintf("failed to get version: %v", err))
+		}
+
 		return err
 	}
 
+	nodeStatus.Version = version.Tag
+
 	// TODO(andrewrynhard): Use semantic versioning to figure out if the
 	// the node is on an older version.
-	upToDate := version.Tag == tag
-
-	switch {
-	case upToDate && inProgess:
-		// This means that the current operator has become the leader, but
-		// another operator initiated the upgrade and failed to remove the
-		// in progress status for some reason. So we skip making an upgrade
-		// request and try to pick up where the upgrade left off.
-		fallthrough
-	case !upToDate && inProgess:
-		// See above case.
-	case upToDate && !inProgess:
+	if version.Tag == tag {
 		v1alpha1.log.Info("node is up to date", "node", node.Name, "version", version.Tag)
-		return nil
-	case !upToDate && !inProgess:
-		v1alpha1.log.Info("upgrading node", "node", node.Name, "current version", version.Tag, "target version", tag, "installer", image)
 
-		// TODO(andrewrynhard): Remove this.
-		time.Sleep(5 * time.Second)
+		nodeStatus.Transition(poolv1alpha1.NodeSucceeded, "")
 
-		v1alpha1.log.Info("sending upgrade request", "node", node.Name)
+		return nil
+	}
 
-		_, err = v1alpha1.talosclient.Upgrade(ctx, image)
-		if err != nil {
-			return fmt.Errorf("upgrade request failed: %w", err)
-		}
+	nodeStatus.PreviousVersion = version.Tag
 
-		if err = v1alpha1.setInProgress(req, node.Name); err != nil {
-			return err
-		}
+	if err = checkUpgradeOptions(pool.Spec.Upgrade, version.Tag); err != nil {
+		nodeStatus.Transition(poolv1alpha1.NodeFailed, err.Error())
+		nodeStatus.Reason = poolv1alpha1.UnsupportedOptionReason
+
+		return err
 	}
 
-	logCtx, logCancel := context.WithCancel(ctx)
+	if pool.Spec.PreUpgrade != nil {
+		nodeStatus.Transition(poolv1alpha1.NodePreUpgrade, "")
 
-	defer logCancel()
+		return nil
+	}
 
-	// TODO(andrewrynhard): Reconnect and stream logs on error.
-	// nolint: errcheck
-	go v1alpha1.streamLogs(logCtx, node)
+	return v1alpha1.requestUpgrade(ctx, t, pool, node, nodeStatus)
+}
+
+func (v1alpha1 *V1Alpha1) requestUpgrade(ctx context.Context, t Timeouts, pool *poolv1alpha1.Pool, node corev1.Node, nodeStatus *poolv1alpha1.NodeStatus) error {
+	image, err := InstallerImage(pool, nodeStatus.TargetVersion)
+	if err != nil {
+		nodeStatus.Transition(poolv1alpha1.NodeFailed, err.Error())
 
-	if err = v1alpha1.verifyUpgrade(ctx, tag, node); err != nil {
 		return err
 	}
 
-	if err = v1alpha1.cleanup(node); err != nil {
+	req := upgradeRequest(image, pool.Spec.Upgrade)
+
+	v1alpha1.log.Info("upgrading node", "node", node.Name, "current version", nodeStatus.Version, "target version", nodeStatus.TargetVersion, "installer", image)
+
+	v1alpha1.log.Info("sending upgrade request", "node", node.Name)
+
+	reqCtx, cancel := context.WithTimeout(ctx, t.Request)
+	defer cancel()
+
+	reqCtx, span := tracing.Start(reqCtx, "Upgrade",
+		tracing.NodeKey.String(node.Name),
+		tracing.VersionKey.String(nodeStatus.Version),
+		tracing.TargetVersionKey.String(nodeStatus.TargetVersion),
+	)
+
+	err = v1alpha1.talosclient.Do(reqCtx, node, func(ctx context.Context, c machineapi.MachineServiceClient) error {
+		_, err := client.FilterMessages(c.Upgrade(ctx, req))
+
 		return err
-	}
+	})
+
+	tracing.End(span, err)
+
+	if err != nil {
+		err = fmt.Errorf("upgrade request failed: %w", err)
+
+		// The request is retried until the node has been unreachable for
+		// longer than it may take to reboot.
+		if expired(nodeStatus.LastTransitionTime, t.Reboot) {
+			nodeStatus.Transition(poolv1alpha1.NodeFailed, err.Error())
+		}
 
-	if err = v1alpha1.removeInProgress(req, node.Name); err != nil {
-		v1alpha1.log.Error(err, "failed to remove node from pool in progress status")
+		return err
 	}
 
-	v1alpha1.log.Info("upgrade successful", "node", node.Name, "version", tag)
+	nodeStatus.Transition(poolv1alpha1.NodeUpgrading, "")
+
+	attempt := NewLogAttempt(pool, nodeStatus)
+	nodeStatus.Log = v1alpha1.logs.Ref(attempt)
+
+	logCtx := v1alpha1.startLogs(ctx, pool.Name, node.Name, t.VersionConvergence)
+
+	go v1alpha1.streamLogs(logCtx, node, attempt)
 
 	return nil
 }
 
-func (v1alpha1 *V1Alpha1) setInProgress(req reconcile.Request, name string) error {
-	var pool poolv1alpha1.Pool
-	if err := v1alpha1.ctrlclient.Get(context.Background(), req.NamespacedName, &pool); err != nil {
-		if apierrors.IsNotFound(err) {
-			return nil
-		}
+// startLogs returns the context of the node's log capture, which is done
+// once the timeout passes or stopLogs is called.
+func (v1alpha1 *V1Alpha1) startLogs(ctx context.Context, pool, node string, timeout time.Duration) context.Context {
+	v1alpha1.mu.Lock()
+	defer v1alpha1.mu.Unlock()
 
-		return err
+	if v1alpha1.streams == nil {
+		v1alpha1.streams = map[string]context.CancelFunc{}
 	}
 
-	f := func(c rune) bool {
-		return c == ','
-	}
+	key := pool + "/" + node
 
-	nodes := strings.FieldsFunc(pool.Status.InProgress, f)
-	nodes = append(nodes, name)
-	pool.Status.InProgress = strings.Join(nodes, ",")
-	if err := v1alpha1.ctrlclient.Update(context.TODO(), &pool); err != nil {
-		return err
+	if cancel, ok := v1alpha1.streams[key]; ok {
+		cancel()
 	}
 
-	return nil
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	v1alpha1.streams[key] = cancel
+
+	return ctx
 }
 
-func (v1alpha1 *V1Alpha1) removeInProgress(req reconcile.Request, name string) error {
-	var pool poolv1alpha1.Pool
-	if err := v1alpha1.ctrlclient.Get(context.Background(), req.NamespacedName, &pool); err != nil {
-		if apierrors.IsNotFound(err) {
+// stopLogs stops capturing the node's log.
+func (v1alpha1 *V1Alpha1) stopLogs(pool, node string) {
+	v1alpha1.mu.Lock()
+	defer v1alpha1.mu.Unlock()
+
+	key := pool + "/" + node
+
+	if cancel, ok := v1alpha1.streams[key]; ok {
+		cancel()
+
+		delete(v1alpha1.streams, key)
+	}
+}
+
+// verifyUpgrade checks if the node has rebooted into the target version. The
+// node is expected to be unreachable while it reboots.
+func (v1alpha1 *V1Alpha1) verifyUpgrade(ctx context.Context, t Timeouts, node corev1.Node, nodeStatus *poolv1alpha1.NodeStatus) error {
+	version, err := v1alpha1.getVersion(ctx, t.Request, node)
+	if err != nil {
+		if expired(nodeStatus.LastTransitionTime, t.Reboot) {
+			nodeStatus.Transition(poolv1alpha1.NodeFailed, fmt.Sprintf("timeout waiting for node to reboot: %v", err))
+
 			return nil
 		}
 
-		return err
+		nodeStatus.Reason = poolv1alpha1.RebootingReason
+
+		return nil
 	}
 
-	nodes := strings.Split(pool.Status.InProgress, ",")
-	tmp := []string{}
-	for _, node := range nodes {
-		if node == name {
-			continue
+	nodeStatus.Version = version.Tag
+
+	if version.Tag != nodeStatus.TargetVersion {
+		if expired(nodeStatus.LastTransitionTime, t.VersionConvergence) {
+			nodeStatus.Transition(poolv1alpha1.NodeFailed, fmt.Sprintf("timeout waiting for node to run %s, node is running %s", nodeStatus.TargetVersion, version.Tag))
 		}
 
-		tmp = append(tmp, node)
-	}
-	pool.Status.InProgress = strings.Join(tmp, ",")
-	if err := v1alpha1.ctrlclient.Update(context.TODO(), &pool); err != nil {
-		return err
+		return nil
 	}
 
+	v1alpha1.log.Info("node is running the target version", "node", node.Name, "version", version.Tag)
+
+	nodeStatus.Transition(poolv1alpha1.NodeVerifying, "")
+
 	return nil
 }
 
-func (v1alpha1 *V1Alpha1) waitForHealthy(node corev1.Node) (err error) {
-	wait := func() error {
-		err = retry.Constant(15*time.Minute, retry.WithUnits(3*time.Second), retry.WithJitter(500*time.Millisecond)).Retry(func() error {
-			n, err := v1alpha1.kubeclient.CoreV1().Nodes().Get(node.Name, metav1.GetOptions{})
+// gate is a health check that must pass within its timeout.
+type gate struct {
+	HealthCheck
+	timeout time.Duration
+}
+
+// gates returns the health checks configured for the pool. The node is
+// always required to be Ready.
+func (v1alpha1 *V1Alpha1) gates(pool *poolv1alpha1.Pool) ([]gate, error) {
+	gates := []gate{{NodeReadyCheck{Client: v1alpha1.kubeclient}, healthyTimeout}}
+
+	checks := pool.Spec.HealthChecks
+	if checks == nil {
+		return gates, nil
+	}
+
+	if checks.Services != nil {
+		gates = append(gates, gate{ServicesCheck{Client: v1alpha1.talosclient, Services: checks.Services.Names}, timeout(checks.Services.Timeout)})
+	}
+
+	if checks.DaemonSets != nil {
+		gates = append(gates, gate{DaemonSetsCheck{Client: v1alpha1.kubeclient}, timeout(checks.DaemonSets.Timeout)})
+	}
+
+	if checks.Etcd != nil {
+		gates = append(gates, gate{v1alpha1.EtcdCheck(), timeout(checks.Etcd.Timeout)})
+	}
+
+	for _, custom := range checks.Custom {
+		switch {
+		case custom.HTTP != nil:
+			gates = append(gates, gate{HTTPCheck{CheckName: custom.Name, URL: custom.HTTP.URL, Addresses: v1alpha1.talosclient.Addresses}, timeout(custom.Timeout)})
+		case custom.Pod != nil:
+			selector, err := metav1.LabelSelectorAsSelector(&custom.Pod.Selector)
 			if err != nil {
-				return retry.ExpectedError(err)
+				return nil, fmt.Errorf("invalid selector for health check %q: %w", custom.Name, err)
 			}
 
-			for _, condition := range n.Status.Conditions {
-				if condition.Type == corev1.NodeReady {
-					if condition.Status == corev1.ConditionFalse {
-						return retry.ExpectedError(errors.New("node not ready"))
-					}
-				}
+			gates = append(gates, gate{PodCheck{Client: v1alpha1.kubeclient, CheckName: custom.Name, Namespace: custom.Pod.Namespace, Selector: selector}, timeout(custom.Timeout)})
+		default:
+			return nil, fmt.Errorf("health check %q requires http or pod", custom.Name)
+		}
+	}
+
+	return gates, nil
+}
+
+// waitForHealthy runs the pool's health checks, and completes the upgrade
+// once they have all passed for the stability window. A check that has not
+// passed within its timeout fails the upgrade.
+func (v1alpha1 *V1Alpha1) waitForHealthy(ctx context.Context, t Timeouts, pool *poolv1alpha1.Pool, node corev1.Node, nodeStatus *poolv1alpha1.NodeStatus) error {
+	gates, err := v1alpha1.gates(pool)
+	if err != nil {
+		nodeStatus.Transition(poolv1alpha1.NodeFailed, err.Error())
+
+		return err
+	}
+
+	for _, g := range gates {
+		if err = check(ctx, t.Request, g, node); err != nil {
+			nodeStatus.HealthySince = nil
+			nodeStatus.Message = fmt.Sprintf("%s: %v", g.Name(), err)
+
+			if expired(nodeStatus.LastTransitionTime, g.timeout) {
+				nodeStatus.Transition(poolv1alpha1.NodeFailed, fmt.Sprintf("health check failed: %s: %v", g.Name(), err))
 			}
 
 			return nil
-		})
+		}
+	}
+
+	nodeStatus.Message = ""
+
+	if nodeStatus.HealthySince == nil {
+		now := metav1.NewTime(time.Now().UTC())
+		nodeStatus.HealthySince = &now
+
+		return nil
+	}
+
+	if !expired(*nodeStatus.HealthySince, t.Stability) {
+		return nil
+	}
+
+	v1alpha1.log.Info("node is healthy", "node", node.Name)
 
+	if err = v1alpha1.cleanup(node); err != nil {
 		return err
 	}
 
-	for i := 0; i < 3; i++ {
-		if err = wait(); err != nil {
-			return err
-		}
+	if pool.Spec.PostUpgrade != nil {
+		nodeStatus.Transition(poolv1alpha1.NodePostUpgrade, "")
 
-		time.Sleep(10 * time.Second)
+		return nil
 	}
 
+	v1alpha1.succeed(node, nodeStatus)
+
 	return nil
 }
 
-func (v1alpha1 *V1Alpha1) getVersion(ctx context.Context) (version *machineapi.VersionInfo, err error) {
-	err = retry.Constant(15*time.Minute, retry.WithUnits(3*time.Second), retry.WithJitter(500*time.Millisecond)).Retry(func() error {
-		var versions *machineapi.VersionResponse
+func (v1alpha1 *V1Alpha1) succeed(node corev1.Node, nodeStatus *poolv1alpha1.NodeStatus) {
+	v1alpha1.log.Info("upgrade successful", "node", node.Name, "version", nodeStatus.TargetVersion)
 
-		versions, err = v1alpha1.talosclient.Version(ctx)
-		if err != nil {
-			return retry.ExpectedError(err)
-		}
+	nodeStatus.Transition(poolv1alpha1.NodeSucceeded, "")
+}
 
-		version = versions.Messages[0].Version
+// runHook runs the hook, and returns true once it has completed. A hook that
+// fails, or does not complete within its timeout, fails the upgrade. Hooks
+// removed from the pool while they run are considered complete.
+func (v1alpha1 *V1Alpha1) runHook(pool *poolv1alpha1.Pool, name string, hook *poolv1alpha1.Hook, nodeStatus *poolv1alpha1.NodeStatus) (bool, error) {
+	if hook == nil {
+		return true, nil
+	}
 
-		return nil
-	})
+	done, err := v1alpha1.hooks.Run(pool, name, hook, nodeStatus)
+	if done {
+		return true, nil
+	}
 
+	_, failed := err.(HookError)
+
+	switch {
+	case failed:
+		nodeStatus.Transition(poolv1alpha1.NodeFailed, fmt.Sprintf("%s hook failed: %v", name, err))
+	case expired(nodeStatus.LastTransitionTime, timeout(hook.Timeout)):
+		nodeStatus.Transition(poolv1alpha1.NodeFailed, fmt.Sprintf("timeout waiting for %s hook", name))
+	}
+
+	return false, err
+}
+
+// TalosClient returns the Talos API client.
+func (v1alpha1 *V1Alpha1) TalosClient() *TalosClient {
+	return v1alpha1.talosclient
+}
+
+// EtcdCheck returns a health check of every etcd member.
+func (v1alpha1 *V1Alpha1) EtcdCheck() HealthCheck {
+	return EtcdCheck{Kubernetes: v1alpha1.kubeclient, Talos: v1alpha1.talosclient}
+}
+
+// LeaderMover returns the mover of etcd leadership off control plane nodes.
+func (v1alpha1 *V1Alpha1) LeaderMover() LeaderMover {
+	return EtcdLeaderMover{Talos: v1alpha1.talosclient}
+}
+
+// InstallerImage returns the installer image for the version, pinned to the
+// digest recorded for the version, if any.
+func InstallerImage(pool *poolv1alpha1.Pool, tag string) (string, error) {
+	image, err := installerImage(pool, tag)
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+
+	if pool.Status.Digest != "" && pool.Status.Version == tag {
+		return registry.PinImage(image, digest.Digest(pool.Status.Digest))
+	}
+
+	return image, nil
+}
+
+// installerImage returns the installer image for the version. The image
+// published by the version source is preferred, falling back to deriving it
+// from the pool's repository.
+func installerImage(pool *poolv1alpha1.Pool, tag string) (string, error) {
+	if pool.Status.Image != "" && pool.Status.Version == tag {
+		return pool.Status.Image, nil
+	}
+
+	if pool.Spec.Repository == "" {
+		return "", errors.New("a repository is required")
 	}
 
-	return version, nil
+	// TODO(andrewrynhard): This should be passed in.
+	return fmt.Sprintf("docker.io/%s:%s", pool.Spec.Repository, tag), nil
 }
 
-func (v1alpha1 *V1Alpha1) streamLogs(ctx context.Context, node corev1.Node) error {
-	stream, err := v1alpha1.talosclient.Logs(ctx, "system", common.ContainerDriver_CONTAINERD, "machined", true, 0)
+func (v1alpha1 *V1Alpha1) getVersion(ctx context.Context, timeout time.Duration, node corev1.Node) (*machineapi.VersionInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var versions *machineapi.VersionResponse
+
+	err := v1alpha1.talosclient.Do(ctx, node, func(ctx context.Context, c machineapi.MachineServiceClient) error {
+		reply, err := client.FilterMessages(c.Version(ctx, &emptypb.Empty{}))
+		versions, _ = reply.(*machineapi.VersionResponse)
+
+		return err
+	})
 	if err != nil {
-		v1alpha1.log.Error(err, "error fetching logs")
+		return nil, err
+	}
+
+	if len(versions.GetMessages()) == 0 {
+		return nil, errors.New("no version returned")
 	}
 
+	return versions.Messages[0].Version, nil
+}
+
+// streamLogs captures the node's machined log until the context is done,
+// reconnecting to the node while it reboots. Every connection reads the whole
+// log of the node's current boot, so that the lines logged before it are not
+// lost, and skips the lines already captured in that boot.
+func (v1alpha1 *V1Alpha1) streamLogs(ctx context.Context, node corev1.Node, attempt LogAttempt) {
+	w := &logWriter{log: v1alpha1.log, sink: v1alpha1.logs, attempt: attempt}
+
+	defer func() {
+		// The context is done, so the rest of the log is written with a new
+		// one.
+		flushCtx, cancel := context.WithTimeout(context.Background(), DefaultRequestTimeout)
+		defer cancel()
+
+		w.flush(flushCtx)
+	}()
+
+	var cursor logCursor
+
 	for {
-		var data *common.Data
-		data, err = stream.Recv()
-		if err != nil {
-			if err == io.EOF || status.Code(err) == codes.Canceled {
-				return nil
+		err := v1alpha1.talosclient.Do(ctx, node, func(ctx context.Context, c machineapi.MachineServiceClient) error {
+			skip := cursor.connect(bootTime(ctx, c))
+
+			stream, err := c.Logs(ctx, &machineapi.LogsRequest{
+				Namespace: "system",
+				Driver:    common.ContainerDriver_CONTAINERD,
+				Id:        "machined",
+				Follow:    true,
+				TailLines: -1,
+			})
+			if err != nil {
+				return err
 			}
 
-			v1alpha1.log.Error(err, "error streaming logs")
+			// Once logs were received, errors are not returned so that they
+			// are not streamed again through the proxied client.
+			received := false
 
-			return err
+			for {
+				var data *common.Data
+				data, err = stream.Recv()
+				if err != nil {
+					if err == io.EOF || status.Code(err) == codes.Canceled || status.Code(err) == codes.DeadlineExceeded {
+						return nil
+					}
+
+					if received {
+						v1alpha1.log.Error(err, "error streaming logs", "node", node.Name)
+
+						return nil
+					}
+
+					return err
+				}
+
+				received = true
+
+				var b []byte
+
+				b, skip = skipLines(data.Bytes, skip)
+
+				cursor.lines += bytes.Count(b, []byte("\n"))
+
+				if len(b) > 0 {
+					w.write(ctx, b)
+				}
+			}
+		})
+		if err != nil {
+			v1alpha1.log.Error(err, "error fetching logs", "node", node.Name)
 		}
 
-		r := bytes.NewReader(data.Bytes)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(logReconnectInterval):
+		}
+	}
+}
+
+// logCursor tracks the lines of a node's log captured in its current boot.
+type logCursor struct {
+	connected bool
+	boot      uint64
+	lines     int
+}
+
+// connect returns the number of lines of the log to skip on a new
+// connection, given the node's boot time. A node whose boot time is unknown
+// is assumed to have rebooted.
+func (c *logCursor) connect(boot uint64) int {
+	if !c.connected || boot == 0 || boot != c.boot {
+		c.lines = 0
+	}
+
+	c.connected = true
+	c.boot = boot
+
+	return c.lines
+}
 
-		scanner := bufio.NewScanner(r)
-		for scanner.Scan() {
-			v1alpha1.log.Info("upgrade log", "node", node.Name, "log", scanner.Text())
+// bootTime returns the node's boot time, or 0 if it is unknown.
+func bootTime(ctx context.Context, c machineapi.MachineServiceClient) uint64 {
+	reply, err := client.FilterMessages(c.SystemStat(ctx, &emptypb.Empty{}))
+	if err != nil {
+		return 0
+	}
+
+	stats, ok := reply.(*machineapi.SystemStatResponse)
+	if !ok || len(stats.GetMessages()) == 0 {
+		return 0
+	}
+
+	return stats.Messages[0].BootTime
+}
+
+// skipLines returns the data that follows the first n lines, and the number
+// of lines left to skip.
+func skipLines(data []byte, n int) ([]byte, int) {
+	for n > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			return nil, n
 		}
+
+		data = data[i+1:]
+		n--
 	}
+
+	return data, 0
 }
 
 func (v1alpha1 *V1Alpha1) cleanup(node corev1.Node) (err error) {
-	if err = v1alpha1.kubeclient.Uncordon(node.Name); err != nil {
+	if err = v1alpha1.uncordon(node.Name); err != nil {
 		v1alpha1.log.Error(err, "failed to undordon node", "node", node.Name)
 	}
 
@@ -351,26 +687,53 @@ func (v1alpha1 *V1Alpha1) cleanup(node corev1.Node) (err error) {
 	return nil
 }
 
-func (v1alpha1 *V1Alpha1) verifyUpgrade(ctx context.Context, tag string, node corev1.Node) error {
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
-	defer cancel()
-	for {
-		version, err := v1alpha1.getVersion(ctx)
+// uncordon marks the node as schedulable.
+func (v1alpha1 *V1Alpha1) uncordon(name string) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := v1alpha1.kubeclient.CoreV1().Nodes().Get(name, metav1.GetOptions{})
 		if err != nil {
 			return err
 		}
 
-		if version.Tag != tag {
-			time.Sleep(10 * time.Second)
-			continue
+		if !node.Spec.Unschedulable {
+			return nil
 		}
 
-		if err = v1alpha1.waitForHealthy(node); err != nil {
-			return fmt.Errorf("node is not healthy: %w", err)
-		}
+		node.Spec.Unschedulable = false
 
-		v1alpha1.log.Info("node is healthy", "node", node.Name)
+		_, err = v1alpha1.kubeclient.CoreV1().Nodes().Update(node)
 
-		return nil
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to uncordon node %s: %w", name, err)
 	}
+
+	return nil
+}
+
+// check runs the health check, bounded by the timeout.
+func check(ctx context.Context, timeout time.Duration, hc HealthCheck, node corev1.Node) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ctx, span := tracing.Start(ctx, "HealthCheck "+hc.Name(), tracing.NodeKey.String(node.Name))
+	defer func() { tracing.End(span, err) }()
+
+	return hc.Check(ctx, node)
+}
+
+// timeout returns the duration, or the default timeout of health checks and
+// hooks if it is unset.
+func timeout(d *metav1.Duration) time.Duration {
+	if d == nil {
+		return healthyTimeout
+	}
+
+	return d.Duration
+}
+
+// expired returns true if more than d has passed since t.
+func expired(t metav1.Time, d time.Duration) bool {
+	return time.Since(t.Time) > d
 }
@@ -0,0 +1,305 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upgrader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	machineapi "github.com/talos-systems/talos/pkg/machinery/api/machine"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	poolv1alpha1 "github.com/talos-systems/talos-controller-manager/api/v1alpha1"
+)
+
+// machineClient is a Talos API client for a node running the version.
+type machineClient struct {
+	machineapi.MachineServiceClient
+
+	version    string
+	versionErr error
+	upgradeErr error
+
+	upgrades []*machineapi.UpgradeRequest
+	forfeits int
+}
+
+func (c *machineClient) Version(context.Context, *emptypb.Empty, ...grpc.CallOption) (*machineapi.VersionResponse, error) {
+	if c.versionErr != nil {
+		return nil, c.versionErr
+	}
+
+	return &machineapi.VersionResponse{Messages: []*machineapi.Version{{Version: &machineapi.VersionInfo{Tag: c.version}}}}, nil
+}
+
+func (c *machineClient) Upgrade(ctx context.Context, req *machineapi.UpgradeRequest, opts ...grpc.CallOption) (*machineapi.UpgradeResponse, error) {
+	if c.upgradeErr != nil {
+		return nil, c.upgradeErr
+	}
+
+	c.upgrades = append(c.upgrades, req)
+
+	return &machineapi.UpgradeResponse{Messages: []*machineapi.Upgrade{{Ack: "Upgrade request received"}}}, nil
+}
+
+func (c *machineClient) SystemStat(context.Context, *emptypb.Empty, ...grpc.CallOption) (*machineapi.SystemStatResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "stats are not reported")
+}
+
+func (c *machineClient) Logs(context.Context, *machineapi.LogsRequest, ...grpc.CallOption) (machineapi.MachineService_LogsClient, error) {
+	return nil, status.Error(codes.Unimplemented, "logs are not captured")
+}
+
+func (c *machineClient) EtcdForfeitLeadership(context.Context, *machineapi.EtcdForfeitLeadershipRequest, ...grpc.CallOption) (*machineapi.EtcdForfeitLeadershipResponse, error) {
+	c.forfeits++
+
+	return &machineapi.EtcdForfeitLeadershipResponse{Messages: []*machineapi.EtcdForfeitLeadership{{Member: "master-1"}}}, nil
+}
+
+// discardLogSink drops the upgrade logs.
+type discardLogSink struct{}
+
+func (discardLogSink) Append(context.Context, LogAttempt, []byte) error {
+	return nil
+}
+
+func (discardLogSink) Ref(LogAttempt) string {
+	return ""
+}
+
+func TestStep(t *testing.T) {
+	unreachable := status.Error(codes.Unavailable, "connection refused")
+
+	tests := []struct {
+		name       string
+		phase      string
+		since      time.Duration
+		client     machineClient
+		wantPhase  string
+		wantReason string
+		wantErr    bool
+		upgrades   int
+	}{
+		{
+			name:      "up to date",
+			phase:     poolv1alpha1.NodePending,
+			client:    machineClient{version: "v0.4.0"},
+			wantPhase: poolv1alpha1.NodeSucceeded,
+		},
+		{
+			name:      "upgrade requested",
+			phase:     poolv1alpha1.NodePending,
+			client:    machineClient{version: "v0.3.0"},
+			wantPhase: poolv1alpha1.NodeUpgrading,
+			upgrades:  1,
+		},
+		{
+			name:      "version unavailable",
+			phase:     poolv1alpha1.NodePending,
+			client:    machineClient{versionErr: unreachable},
+			wantPhase: poolv1alpha1.NodePending,
+			wantErr:   true,
+		},
+		{
+			name:      "version unavailable for too long",
+			phase:     poolv1alpha1.NodePending,
+			since:     time.Hour,
+			client:    machineClient{versionErr: unreachable},
+			wantPhase: poolv1alpha1.NodeFailed,
+			wantErr:   true,
+		},
+		{
+			name:      "upgrade request failed",
+			phase:     poolv1alpha1.NodePending,
+			client:    machineClient{version: "v0.3.0", upgradeErr: unreachable},
+			wantPhase: poolv1alpha1.NodePending,
+			wantErr:   true,
+		},
+		{
+			name:      "upgrade request failed for too long",
+			phase:     poolv1alpha1.NodePending,
+			since:     time.Hour,
+			client:    machineClient{version: "v0.3.0", upgradeErr: unreachable},
+			wantPhase: poolv1alpha1.NodeFailed,
+			wantErr:   true,
+		},
+		{
+			name:       "rebooting",
+			phase:      poolv1alpha1.NodeUpgrading,
+			client:     machineClient{versionErr: unreachable},
+			wantPhase:  poolv1alpha1.NodeUpgrading,
+			wantReason: poolv1alpha1.RebootingReason,
+		},
+		{
+			name:      "reboot timed out",
+			phase:     poolv1alpha1.NodeUpgrading,
+			since:     time.Hour,
+			client:    machineClient{versionErr: unreachable},
+			wantPhase: poolv1alpha1.NodeFailed,
+		},
+		{
+			name:      "running the previous version",
+			phase:     poolv1alpha1.NodeUpgrading,
+			client:    machineClient{version: "v0.3.0"},
+			wantPhase: poolv1alpha1.NodeUpgrading,
+		},
+		{
+			name:      "running the target version",
+			phase:     poolv1alpha1.NodeUpgrading,
+			client:    machineClient{version: "v0.4.0"},
+			wantPhase: poolv1alpha1.NodeVerifying,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newNode("worker-1", false)
+			node.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.5.0.3"}}
+
+			c := tt.client
+
+			v := &V1Alpha1{
+				log: ctrl.Log,
+				talosclient: &TalosClient{
+					Direct: true,
+					log:    ctrl.Log,
+					client: &c,
+					nodes:  map[string]directClient{"worker-1": {address: "10.5.0.3", client: &c}},
+				},
+				kubeclient: fake.NewSimpleClientset(&node),
+				logs:       discardLogSink{},
+			}
+
+			pool := &poolv1alpha1.Pool{
+				ObjectMeta: metav1.ObjectMeta{Name: "workers"},
+				Spec:       poolv1alpha1.PoolSpec{Repository: "autonomy/installer"},
+			}
+
+			nodeStatus := &poolv1alpha1.NodeStatus{
+				Name:               node.Name,
+				Phase:              tt.phase,
+				TargetVersion:      "v0.4.0",
+				LastTransitionTime: metav1.NewTime(time.Now().Add(-tt.since)),
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// The log of an upgrading node is being captured.
+			var logCtx context.Context
+
+			if tt.phase == poolv1alpha1.NodeUpgrading {
+				logCtx = v.startLogs(ctx, pool.Name, node.Name, time.Minute)
+			}
+
+			if err := v.Step(ctx, pool, node, nodeStatus); (err != nil) != tt.wantErr {
+				t.Errorf("Step() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if nodeStatus.Phase != tt.wantPhase {
+				t.Errorf("Step() phase = %q, want %q", nodeStatus.Phase, tt.wantPhase)
+			}
+
+			if nodeStatus.Reason != tt.wantReason {
+				t.Errorf("Step() reason = %q, want %q", nodeStatus.Reason, tt.wantReason)
+			}
+
+			if len(c.upgrades) != tt.upgrades {
+				t.Errorf("Step() requested %d upgrade(s), want %d", len(c.upgrades), tt.upgrades)
+			}
+
+			if streaming := len(v.streams) > 0; streaming != (tt.wantPhase == poolv1alpha1.NodeUpgrading) {
+				t.Errorf("Step() capturing logs = %v, want %v", streaming, !streaming)
+			}
+
+			if logCtx != nil && tt.wantPhase != poolv1alpha1.NodeUpgrading && logCtx.Err() == nil {
+				t.Error("Step() did not stop capturing the log once the node left Upgrading")
+			}
+		})
+	}
+}
+
+func TestInstallerImage(t *testing.T) {
+	const dgst = "sha256:4ee6ee1e9a3b8d5a7a6d0b6a3b5d9c0e3c5c0a5a2f8b1f3e7e6d4c3b2a190817"
+
+	tests := []struct {
+		name   string
+		status poolv1alpha1.PoolStatus
+		tag    string
+		want   string
+	}{
+		{
+			name: "derived",
+			tag:  "v0.4.0",
+			want: "docker.io/autonomy/installer:v0.4.0",
+		},
+		{
+			name:   "published",
+			status: poolv1alpha1.PoolStatus{Version: "v0.4.0", Image: "ghcr.io/talos-systems/installer:v0.4.0"},
+			tag:    "v0.4.0",
+			want:   "ghcr.io/talos-systems/installer:v0.4.0",
+		},
+		{
+			name:   "pinned",
+			status: poolv1alpha1.PoolStatus{Version: "v0.4.0", Digest: dgst},
+			tag:    "v0.4.0",
+			want:   "docker.io/autonomy/installer@" + dgst,
+		},
+		{
+			name:   "pinned to another version",
+			status: poolv1alpha1.PoolStatus{Version: "v0.5.0", Digest: dgst},
+			tag:    "v0.4.0",
+			want:   "docker.io/autonomy/installer:v0.4.0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := &poolv1alpha1.Pool{
+				Spec:   poolv1alpha1.PoolSpec{Repository: "autonomy/installer"},
+				Status: tt.status,
+			}
+
+			got, err := InstallerImage(pool, tt.tag)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("InstallerImage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEtcdLeaderMover(t *testing.T) {
+	node := newNode("master-1", true)
+	node.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.5.0.2"}}
+
+	c := &machineClient{}
+
+	mover := EtcdLeaderMover{
+		Talos: &TalosClient{
+			Direct: true,
+			log:    ctrl.Log,
+			client: c,
+			nodes:  map[string]directClient{"master-1": {address: "10.5.0.2", client: c}},
+		},
+	}
+
+	if err := mover.MoveLeader(context.Background(), node); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.forfeits != 1 {
+		t.Errorf("MoveLeader() forfeited leadership %d time(s), want 1", c.forfeits)
+	}
+}
@@ -0,0 +1,218 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package version
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/talos-systems/talos-controller-manager/pkg/channel"
+)
+
+// ConfigMap is a cache that persists each channel's entry in a ConfigMap so
+// that a newly elected leader can start without querying the registry. The
+// ConfigMap has one key per channel, each holding the JSON encoded Entry.
+type ConfigMap struct {
+	// Owner, if set, owns the ConfigMap, so that it is deleted with it.
+	Owner *metav1.OwnerReference
+
+	client ctrlclient.Client
+	name   types.NamespacedName
+
+	entries map[channel.Channel]Entry
+
+	log logr.Logger
+	mu  sync.Mutex
+
+	// persisting serializes the writes to the ConfigMap, so that mu is not
+	// held while waiting on the API server.
+	persisting sync.Mutex
+}
+
+// legacyEntry is an Entry as persisted before entries recorded their source
+// by name.
+type legacyEntry struct {
+	Entry
+
+	Registry   string `json:"registry"`
+	Repository string `json:"repository"`
+}
+
+// ConfigMapName returns the name of the ConfigMap persisting the pool's
+// versions.
+func ConfigMapName(pool string) string {
+	return pool + "-versions"
+}
+
+func NewConfigMap(client ctrlclient.Client, namespace, name string) *ConfigMap {
+	return &ConfigMap{
+		client:  client,
+		name:    types.NamespacedName{Namespace: namespace, Name: name},
+		entries: map[channel.Channel]Entry{},
+		log:     ctrl.Log.WithName("version").WithName("ConfigMap"),
+	}
+}
+
+// Load seeds the cache with the entries stored in the ConfigMap. A missing
+// ConfigMap is not an error.
+func (cm *ConfigMap) Load(ctx context.Context) error {
+	var configMap corev1.ConfigMap
+
+	if err := cm.client.Get(ctx, cm.name, &configMap); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	for c, data := range configMap.Data {
+		var entry legacyEntry
+
+		if err := json.Unmarshal([]byte(data), &entry); err != nil {
+			cm.log.Error(err, "skipping invalid entry", "configmap", cm.name, "channel", c)
+			continue
+		}
+
+		if entry.Source == "" && entry.Registry != "" {
+			entry.Source = entry.Registry + "/" + entry.Repository
+		}
+
+		cm.entries[c] = entry.Entry
+	}
+
+	return nil
+}
+
+// Retain drops the entries that were not resolved by the source, so that the
+// versions of a previous source are not used.
+func (cm *ConfigMap) Retain(source string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	for c, entry := range cm.entries {
+		if entry.Source != source {
+			delete(cm.entries, c)
+		}
+	}
+}
+
+func (cm *ConfigMap) Get(c channel.Channel) (string, bool) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	entry, ok := cm.entries[c]
+
+	return entry.Version, ok
+}
+
+// Entry returns the full entry recorded for the channel.
+func (cm *ConfigMap) Entry(c channel.Channel) (Entry, bool) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	entry, ok := cm.entries[c]
+
+	return entry, ok
+}
+
+// Entries returns a copy of the entries of every channel.
+func (cm *ConfigMap) Entries() map[channel.Channel]Entry {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	entries := make(map[channel.Channel]Entry, len(cm.entries))
+	for c, entry := range cm.entries {
+		entries[c] = entry
+	}
+
+	return entries
+}
+
+func (cm *ConfigMap) Set(c channel.Channel, value string) {
+	cm.SetEntry(c, Entry{Version: value})
+}
+
+func (cm *ConfigMap) SetEntry(c channel.Channel, entry Entry) {
+	cm.mu.Lock()
+	cm.entries[c] = entry
+	cm.mu.Unlock()
+
+	cm.persisting.Lock()
+	defer cm.persisting.Unlock()
+
+	// Another leader, or an older controller, may have written the ConfigMap
+	// since we read it.
+	err := retry.OnError(retry.DefaultRetry, func(err error) bool {
+		return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
+	}, func() error {
+		return cm.persist(context.Background(), c)
+	})
+	if err != nil {
+		cm.log.Error(err, "failed to persist entry", "configmap", cm.name, "channel", c)
+	}
+}
+
+// persist writes the channel's current entry to the ConfigMap.
+func (cm *ConfigMap) persist(ctx context.Context, c channel.Channel) error {
+	cm.mu.Lock()
+	entry := cm.entries[c]
+	cm.mu.Unlock()
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	var configMap corev1.ConfigMap
+
+	if err = cm.client.Get(ctx, cm.name, &configMap); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+
+		configMap = corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: cm.name.Namespace,
+				Name:      cm.name.Name,
+			},
+			Data: map[string]string{
+				c: string(b),
+			},
+		}
+
+		if cm.Owner != nil {
+			configMap.OwnerReferences = []metav1.OwnerReference{*cm.Owner}
+		}
+
+		return cm.client.Create(ctx, &configMap)
+	}
+
+	// ConfigMaps persisted before they were owned are adopted.
+	if cm.Owner != nil && len(configMap.OwnerReferences) == 0 {
+		configMap.OwnerReferences = []metav1.OwnerReference{*cm.Owner}
+	}
+
+	if configMap.Data == nil {
+		configMap.Data = map[string]string{}
+	}
+
+	configMap.Data[c] = string(b)
+
+	return cm.client.Update(ctx, &configMap)
+}
@@ -0,0 +1,152 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package version
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/talos-systems/talos-controller-manager/pkg/channel"
+)
+
+func TestConfigMapLoad(t *testing.T) {
+	discovered := time.Date(2020, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		data map[string]string
+		want map[channel.Channel]Entry
+	}{
+		{
+			name: "missing",
+			want: map[channel.Channel]Entry{},
+		},
+		{
+			name: "entry",
+			data: map[string]string{
+				channel.StableChannel: `{"version":"v0.4.0","source":"github.com/talos-systems/talos","discovered":"2020-03-01T12:00:00Z"}`,
+			},
+			want: map[channel.Channel]Entry{
+				channel.StableChannel: {Version: "v0.4.0", Source: "github.com/talos-systems/talos", Discovered: discovered},
+			},
+		},
+		{
+			name: "legacy entry",
+			data: map[string]string{
+				channel.StableChannel: `{"version":"v0.4.0","registry":"docker.io","repository":"autonomy/installer","discovered":"2020-03-01T12:00:00Z"}`,
+			},
+			want: map[channel.Channel]Entry{
+				channel.StableChannel: {Version: "v0.4.0", Source: "docker.io/autonomy/installer", Discovered: discovered},
+			},
+		},
+		{
+			name: "invalid entry",
+			data: map[string]string{
+				channel.StableChannel: `{"version":"v0.4.0","source":"docker.io/autonomy/installer","discovered":"2020-03-01T12:00:00Z"}`,
+				channel.EdgeChannel:   `v0.5.0-alpha.0`,
+			},
+			want: map[channel.Channel]Entry{
+				channel.StableChannel: {Version: "v0.4.0", Source: "docker.io/autonomy/installer", Discovered: discovered},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objs []runtime.Object
+
+			if tt.data != nil {
+				objs = append(objs, &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: ConfigMapName("workers")},
+					Data:       tt.data,
+				})
+			}
+
+			c := fake.NewFakeClientWithScheme(clientgoscheme.Scheme, objs...)
+
+			cm := NewConfigMap(c, "default", ConfigMapName("workers"))
+
+			if err := cm.Load(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := cm.Entries(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Load() entries = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigMapSetEntry(t *testing.T) {
+	discovered := time.Date(2020, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	c := fake.NewFakeClientWithScheme(clientgoscheme.Scheme)
+
+	cm := NewConfigMap(c, "default", ConfigMapName("workers"))
+	cm.Owner = &metav1.OwnerReference{APIVersion: "upgrade.talos.dev/v1alpha1", Kind: "Pool", Name: "workers", UID: "1234"}
+
+	want := map[channel.Channel]Entry{
+		channel.StableChannel: {Version: "v0.4.0", Source: "docker.io/autonomy/installer", Discovered: discovered},
+		channel.EdgeChannel:   {Version: "v0.5.0-alpha.0", Source: "docker.io/autonomy/installer", Discovered: discovered},
+	}
+
+	// The first entry creates the ConfigMap and the second updates it.
+	cm.SetEntry(channel.StableChannel, want[channel.StableChannel])
+	cm.SetEntry(channel.EdgeChannel, want[channel.EdgeChannel])
+
+	var configMap corev1.ConfigMap
+
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: ConfigMapName("workers")}, &configMap); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(configMap.Data) != len(want) {
+		t.Errorf("SetEntry() persisted %d entries, want %d", len(configMap.Data), len(want))
+	}
+
+	if !reflect.DeepEqual(configMap.OwnerReferences, []metav1.OwnerReference{*cm.Owner}) {
+		t.Errorf("SetEntry() owner references = %v, want %v", configMap.OwnerReferences, []metav1.OwnerReference{*cm.Owner})
+	}
+
+	// A newly elected leader sees the same entries.
+	loaded := NewConfigMap(c, "default", ConfigMapName("workers"))
+
+	if err := loaded.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := loaded.Entries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Load() entries = %v, want %v", got, want)
+	}
+
+	if got, ok := loaded.Get(channel.StableChannel); !ok || got != "v0.4.0" {
+		t.Errorf("Get() = %q, %v, want %q, true", got, ok, "v0.4.0")
+	}
+}
+
+func TestConfigMapRetain(t *testing.T) {
+	cm := NewConfigMap(fake.NewFakeClientWithScheme(clientgoscheme.Scheme), "default", ConfigMapName("workers"))
+
+	cm.entries[channel.StableChannel] = Entry{Version: "v0.4.0", Source: "docker.io/autonomy/installer"}
+	cm.entries[channel.EdgeChannel] = Entry{Version: "v0.5.0-alpha.0", Source: "github.com/talos-systems/talos"}
+
+	cm.Retain("github.com/talos-systems/talos")
+
+	if _, ok := cm.Get(channel.StableChannel); ok {
+		t.Error("Retain() kept the entry of another source")
+	}
+
+	if _, ok := cm.Get(channel.EdgeChannel); !ok {
+		t.Error("Retain() dropped the entry of the source")
+	}
+}
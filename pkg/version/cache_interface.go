@@ -5,6 +5,8 @@
 package version
 
 import (
+	"time"
+
 	"github.com/talos-systems/talos-controller-manager/pkg/channel"
 )
 
@@ -12,3 +14,24 @@ type Cache interface {
 	Get(channel.Channel) (string, bool)
 	Set(channel.Channel, string)
 }
+
+// EntryCache is implemented by caches that record where and when a channel's
+// version was discovered, in addition to the version itself.
+type EntryCache interface {
+	Cache
+
+	Entry(channel.Channel) (Entry, bool)
+	SetEntry(channel.Channel, Entry)
+}
+
+// Entry describes a resolved channel version. It is persisted as JSON, keyed
+// by channel, in the versions ConfigMap. Source is the name of the version
+// source that resolved it, e.g. "docker.io/autonomy/installer" or
+// "github.com/talos-systems/talos".
+type Entry struct {
+	Version    string    `json:"version"`
+	Image      string    `json:"image,omitempty"`
+	Digest     string    `json:"digest,omitempty"`
+	Source     string    `json:"source"`
+	Discovered time.Time `json:"discovered"`
+}
@@ -0,0 +1,162 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package version
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/talos-systems/talos-controller-manager/pkg/channel"
+	"github.com/talos-systems/talos-controller-manager/pkg/channel/filter"
+)
+
+const DefaultGitHubURL = "https://api.github.com"
+
+// MaxGitHubPages bounds the number of pages of releases listed, 100 releases
+// each.
+const MaxGitHubPages = 10
+
+// GitHubSource resolves channels from the releases published through a
+// GitHub-Releases-style JSON API.
+type GitHubSource struct {
+	// URL is the base URL of the API. It defaults to DefaultGitHubURL.
+	URL string
+	// Repository is the owner/name of the repository publishing releases.
+	Repository string
+
+	Client *http.Client
+}
+
+type gitHubRelease struct {
+	TagName    string `json:"tag_name"`
+	Draft      bool   `json:"draft"`
+	Prerelease bool   `json:"prerelease"`
+}
+
+func (s *GitHubSource) Name() string {
+	return s.url() + "/repos/" + s.Repository
+}
+
+func (s *GitHubSource) Resolve(ctx context.Context, channels []channel.Channel) (map[channel.Channel]Release, error) {
+	var list []gitHubRelease
+
+	// Follow the pages of releases, newest first.
+	next := s.Name() + "/releases?per_page=100"
+
+	for page := 0; next != "" && page < MaxGitHubPages; page++ {
+		releases, link, err := s.list(ctx, next)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, releases...)
+		next = nextLink(link)
+	}
+
+	var all, releases []string
+
+	for _, r := range list {
+		if r.Draft {
+			continue
+		}
+
+		all = append(all, r.TagName)
+
+		if !r.Prerelease {
+			releases = append(releases, r.TagName)
+		}
+	}
+
+	resolved := map[channel.Channel]Release{}
+
+	for _, c := range channels {
+		var found *string
+
+		switch c {
+		case channel.StableChannel:
+			found = filter.FilterSemver(c, releases)
+		case channel.LatestChannel, channel.EdgeChannel, channel.AlphaChannel, channel.BetaChannel:
+			found = filter.FilterSemver(c, all)
+		default:
+			return nil, channel.NewInvalidChannelError(c)
+		}
+
+		if found == nil {
+			continue
+		}
+
+		resolved[c] = Release{Version: *found}
+	}
+
+	return resolved, nil
+}
+
+// list returns a page of releases, and the response's Link header.
+func (s *GitHubSource) list(ctx context.Context, url string) ([]gitHubRelease, string, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	resp, err := s.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, "", err
+	}
+
+	// nolint: errcheck
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("failed to list releases of %q: %s", s.Repository, resp.Status)
+	}
+
+	var list []gitHubRelease
+
+	if err = json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, "", fmt.Errorf("failed to decode releases of %q: %w", s.Repository, err)
+	}
+
+	return list, resp.Header.Get("Link"), nil
+}
+
+// nextLink returns the URL of the next page in a Link header, or an empty
+// string on the last page.
+func nextLink(header string) string {
+	for _, link := range strings.Split(header, ",") {
+		parts := strings.Split(link, ";")
+		if len(parts) < 2 {
+			continue
+		}
+
+		for _, param := range parts[1:] {
+			if strings.TrimSpace(param) == `rel="next"` {
+				return strings.Trim(strings.TrimSpace(parts[0]), "<>")
+			}
+		}
+	}
+
+	return ""
+}
+
+func (s *GitHubSource) url() string {
+	if s.URL == "" {
+		return DefaultGitHubURL
+	}
+
+	return strings.TrimSuffix(s.URL, "/")
+}
+
+func (s *GitHubSource) client() *http.Client {
+	if s.Client == nil {
+		return http.DefaultClient
+	}
+
+	return s.Client
+}
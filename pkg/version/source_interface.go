@@ -0,0 +1,30 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package version
+
+import (
+	"context"
+
+	"github.com/talos-systems/talos-controller-manager/pkg/channel"
+)
+
+// VersionSource resolves the current version of each channel.
+type VersionSource interface {
+	// Name describes where the versions come from (e.g. a registry or URL).
+	Name() string
+	// Resolve returns the release for each channel that could be resolved.
+	// Channels without a release are omitted from the result.
+	Resolve(context.Context, []channel.Channel) (map[channel.Channel]Release, error)
+}
+
+// Release is a version resolved by a VersionSource.
+type Release struct {
+	Version string
+	// Image is the installer image for the version. It is empty when the
+	// source does not know it, in which case it is derived from the pool's
+	// repository.
+	Image  string
+	Digest string
+}
@@ -0,0 +1,118 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package version
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/blang/semver"
+	"sigs.k8s.io/yaml"
+
+	"github.com/talos-systems/talos-controller-manager/pkg/channel"
+)
+
+// ManifestSource resolves channels from a curated release manifest served
+// over HTTP(S). The manifest is JSON or YAML of the form:
+//
+//	versions:
+//	  - version: v0.4.0
+//	    channels: [stable, beta, alpha]
+//	    image: docker.io/autonomy/installer:v0.4.0
+//	    digest: sha256:...
+//
+// Each channel resolves to the newest version that lists it.
+type ManifestSource struct {
+	URL string
+
+	Client *http.Client
+}
+
+type Manifest struct {
+	Versions []ManifestVersion `json:"versions"`
+}
+
+type ManifestVersion struct {
+	Version  string            `json:"version"`
+	Channels []channel.Channel `json:"channels"`
+	Image    string            `json:"image,omitempty"`
+	Digest   string            `json:"digest,omitempty"`
+}
+
+func (s *ManifestSource) Name() string {
+	return s.URL
+}
+
+func (s *ManifestSource) Resolve(ctx context.Context, channels []channel.Channel) (map[channel.Channel]Release, error) {
+	req, err := http.NewRequest(http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c := s.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	// nolint: errcheck
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch release manifest %q: %s", s.URL, resp.Status)
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+
+	// YAML is a superset of JSON, so this handles both.
+	if err = yaml.Unmarshal(b, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to decode release manifest %q: %w", s.URL, err)
+	}
+
+	wanted := map[channel.Channel]bool{}
+	for _, c := range channels {
+		wanted[c] = true
+	}
+
+	resolved := map[channel.Channel]Release{}
+	newest := map[channel.Channel]semver.Version{}
+
+	for _, v := range manifest.Versions {
+		parsed, err := semver.ParseTolerant(v.Version)
+		if err != nil {
+			continue
+		}
+
+		for _, c := range v.Channels {
+			if !wanted[c] {
+				continue
+			}
+
+			if n, ok := newest[c]; ok && !n.LT(parsed) {
+				continue
+			}
+
+			newest[c] = parsed
+			resolved[c] = Release{
+				Version: v.Version,
+				Image:   v.Image,
+				Digest:  v.Digest,
+			}
+		}
+	}
+
+	return resolved, nil
+}
@@ -0,0 +1,90 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package version
+
+import (
+	"context"
+	"log"
+
+	"github.com/talos-systems/talos-controller-manager/pkg/channel"
+	"github.com/talos-systems/talos-controller-manager/pkg/channel/filter"
+	"github.com/talos-systems/talos-controller-manager/pkg/registry"
+)
+
+// RegistrySource resolves channels from the tags of a container registry
+// repository.
+type RegistrySource struct {
+	Registry   string
+	Repository string
+	Options    []registry.TagsOption
+}
+
+func (s *RegistrySource) Name() string {
+	return s.Registry + "/" + s.Repository
+}
+
+func (s *RegistrySource) Resolve(ctx context.Context, channels []channel.Channel) (map[channel.Channel]Release, error) {
+	repo, err := registry.New(ctx, s.Registry, s.Repository)
+	if err != nil {
+		return nil, err
+	}
+
+	semvers := map[channel.Channel]*filter.Semver{}
+
+	for _, c := range channels {
+		switch c {
+		case channel.AlphaChannel, channel.BetaChannel, channel.StableChannel:
+			semvers[c] = filter.NewSemver(c)
+		}
+	}
+
+	// Stream the tags through the filters a page at a time instead of
+	// holding every tag in memory.
+	if len(semvers) > 0 {
+		err = repo.TagPages(ctx, func(page []string) error {
+			for _, f := range semvers {
+				f.Add(page)
+			}
+
+			return nil
+		}, s.Options...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	releases := map[channel.Channel]Release{}
+
+	for _, c := range channels {
+		var found *string
+
+		switch c {
+		case channel.LatestChannel, channel.EdgeChannel:
+			found = filter.FilterTagsFor(ctx, c, s.Registry, s.Repository)
+		case channel.AlphaChannel, channel.BetaChannel, channel.StableChannel:
+			found = semvers[c].Target()
+		default:
+			log.Printf("%v", channel.NewInvalidChannelError(c))
+			continue
+		}
+
+		if found == nil || *found == "" {
+			continue
+		}
+
+		release := Release{Version: *found}
+
+		dgst, err := repo.Digest(ctx, *found)
+		if err != nil {
+			log.Printf("failed to get digest for %q: %v", *found, err)
+		} else {
+			release.Digest = dgst.String()
+		}
+
+		releases[c] = release
+	}
+
+	return releases, nil
+}
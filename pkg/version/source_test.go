@@ -0,0 +1,147 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package version
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/talos-systems/talos-controller-manager/pkg/channel"
+)
+
+func TestVersionSources(t *testing.T) {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/v2/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Docker-Distribution-Api-Version", "registry/2.0")
+	})
+
+	mux.HandleFunc("/v2/autonomy/installer/tags/list", func(w http.ResponseWriter, r *http.Request) {
+		// nolint: errcheck
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"name": "autonomy/installer",
+			"tags": []string{"latest", "v0.3.0", "v0.4.0-alpha.1", "v0.4.0-alpha.1-3-gabcdef"},
+		})
+	})
+
+	mux.HandleFunc("/repos/talos-systems/talos/releases", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			// nolint: errcheck
+			json.NewEncoder(w).Encode([]gitHubRelease{
+				{TagName: "v0.3.1"},
+				{TagName: "v0.3.0"},
+			})
+
+			return
+		}
+
+		w.Header().Set("Link", `<http://`+r.Host+`/repos/talos-systems/talos/releases?per_page=100&page=2>; rel="next", <http://`+r.Host+`/repos/talos-systems/talos/releases?per_page=100&page=2>; rel="last"`)
+
+		// nolint: errcheck
+		json.NewEncoder(w).Encode([]gitHubRelease{
+			{TagName: "v0.5.0-alpha.0", Draft: true},
+			{TagName: "v0.4.0-beta.0", Prerelease: true},
+		})
+	})
+
+	mux.HandleFunc("/releases.yaml", func(w http.ResponseWriter, r *http.Request) {
+		// nolint: errcheck
+		w.Write([]byte(`versions:
+  - version: v0.3.0
+    channels: [stable, beta]
+    image: example.com/installer:v0.3.0
+    digest: sha256:0
+  - version: v0.4.0-beta.0
+    channels: [beta]
+    image: example.com/installer:v0.4.0-beta.0
+  - version: v0.2.0
+    channels: [stable]
+`))
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		source   VersionSource
+		channels []channel.Channel
+		want     map[channel.Channel]Release
+	}{
+		{
+			name:     "registry",
+			source:   &RegistrySource{Registry: server.URL, Repository: "autonomy/installer"},
+			channels: []channel.Channel{channel.AlphaChannel, channel.StableChannel},
+			want: map[channel.Channel]Release{
+				channel.AlphaChannel:  {Version: "v0.4.0-alpha.1"},
+				channel.StableChannel: {Version: "v0.3.0"},
+			},
+		},
+		{
+			name:     "github",
+			source:   &GitHubSource{URL: server.URL, Repository: "talos-systems/talos"},
+			channels: []channel.Channel{channel.BetaChannel, channel.StableChannel},
+			want: map[channel.Channel]Release{
+				channel.BetaChannel:   {Version: "v0.4.0-beta.0"},
+				channel.StableChannel: {Version: "v0.3.1"},
+			},
+		},
+		{
+			name:     "manifest",
+			source:   &ManifestSource{URL: server.URL + "/releases.yaml"},
+			channels: []channel.Channel{channel.BetaChannel, channel.StableChannel, channel.AlphaChannel},
+			want: map[channel.Channel]Release{
+				channel.BetaChannel:   {Version: "v0.4.0-beta.0", Image: "example.com/installer:v0.4.0-beta.0"},
+				channel.StableChannel: {Version: "v0.3.0", Image: "example.com/installer:v0.3.0", Digest: "sha256:0"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.source.Resolve(context.Background(), tt.channels)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The test registry does not serve manifests, so digests are
+			// not resolved.
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Resolve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextLink(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{
+			name:   "next",
+			header: `<https://api.github.com/releases?page=2>; rel="next", <https://api.github.com/releases?page=5>; rel="last"`,
+			want:   "https://api.github.com/releases?page=2",
+		},
+		{
+			name:   "last page",
+			header: `<https://api.github.com/releases?page=1>; rel="first", <https://api.github.com/releases?page=4>; rel="prev"`,
+		},
+		{
+			name: "no header",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextLink(tt.header); got != tt.want {
+				t.Errorf("nextLink() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
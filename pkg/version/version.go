@@ -5,96 +5,136 @@
 package version
 
 import (
-	"log"
+	"context"
 	"sync"
 	"time"
 
 	"github.com/talos-systems/talos-controller-manager/pkg/channel"
-	"github.com/talos-systems/talos-controller-manager/pkg/channel/filter"
-	"github.com/talos-systems/talos-controller-manager/pkg/registry"
+	"github.com/talos-systems/talos-controller-manager/pkg/metrics"
+	"github.com/talos-systems/talos-controller-manager/pkg/tracing"
 )
 
+// ResolveInterval is the interval between resolutions of the versions.
+const ResolveInterval = 5 * time.Minute
+
 type Version struct {
 	Cache
 
 	synced chan struct{}
+	once   sync.Once
+
+	mu  sync.Mutex
+	err error
 }
 
 func NewVersion(cache Cache) *Version {
 	return &Version{
 		Cache:  cache,
-		synced: make(chan struct{}, 1),
+		synced: make(chan struct{}),
 	}
 }
 
-func (v Version) WaitForCacheSync() bool {
+// WaitForCacheSync blocks until the first resolution has finished, and
+// returns false if it does not finish in time.
+func (v *Version) WaitForCacheSync(ctx context.Context) bool {
 	select {
 	case <-v.synced:
 		return true
+	case <-ctx.Done():
+		return false
 	case <-time.After(time.Minute):
 		return false
 	}
 }
 
-func (v Version) Run(reg, repository string, channels []channel.Channel) error {
-	repo, err := registry.New(reg, repository)
-	if err != nil {
-		return err
-	}
+// Err returns the error of the last resolution, or nil if it succeeded.
+func (v *Version) Err() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
 
+	return v.err
+}
+
+// Run resolves the versions of the channels every ResolveInterval until the
+// context is cancelled. A failed resolution is retried at the next interval,
+// and its error is returned by Err in the meantime.
+func (v *Version) Run(ctx context.Context, source VersionSource, channels []channel.Channel) {
 	for {
-		tags, err := repo.Tags()
-		if err != nil {
-			return err
-		}
+		err := v.resolve(ctx, source, channels)
 
-		var wg sync.WaitGroup
+		v.mu.Lock()
+		v.err = err
+		v.mu.Unlock()
 
-		wg.Add(len(channels))
+		v.once.Do(func() { close(v.synced) })
 
-		for _, channel := range channels {
-			go func(c string) {
-				defer wg.Done()
-				v.discover(c, reg, repository, tags)
-			}(channel)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(ResolveInterval):
 		}
+	}
+}
+
+func (v *Version) resolve(ctx context.Context, source VersionSource, channels []channel.Channel) error {
+	ctx, span := tracing.Start(ctx, "Resolve", tracing.ChannelKey.StringSlice(channelNames(channels)))
 
-		wg.Wait()
+	releases, err := source.Resolve(ctx, channels)
 
-		v.synced <- struct{}{}
+	tracing.End(span, err)
 
-		time.Sleep(5 * time.Minute)
+	if err != nil {
+		return err
+	}
+
+	for c, release := range releases {
+		v.discover(c, source, release)
+
+		if release.Version != "" {
+			metrics.ChannelResolved.WithLabelValues(string(c), source.Name()).SetToCurrentTime()
+		}
 	}
+
+	return nil
 }
 
-func (v Version) discover(c, reg, repo string, tags []string) {
-	var found *string
-	switch c {
-	case channel.LatestChannel:
-		found = filter.FilterTagsFor(channel.LatestChannel, reg, repo)
-	case channel.EdgeChannel:
-		found = filter.FilterTagsFor(channel.EdgeChannel, reg, repo)
-	case channel.AlphaChannel, channel.BetaChannel, channel.StableChannel:
-		found = filter.FilterSemver(c, tags)
-	default:
-		log.Printf("%v", channel.NewInvalidChannelError(c))
+func (v *Version) discover(c channel.Channel, source VersionSource, release Release) {
+	if release.Version == "" {
 		return
 	}
 
-	if found == nil {
+	cache, ok := v.Cache.(EntryCache)
+	if !ok {
+		// No change in version.
+		if version, ok := v.Get(c); ok && version == release.Version {
+			return
+		}
+
+		v.Set(c, release.Version)
+
 		return
 	}
 
-	if *found == "" {
+	// No change in the release, nor in where it was resolved from.
+	if entry, ok := cache.Entry(c); ok && entry.Version == release.Version && entry.Source == source.Name() && entry.Image == release.Image && entry.Digest == release.Digest {
 		return
 	}
 
-	// No change in version.
-	version, ok := v.Get(c)
-	if ok && version == *found {
-		return
+	// A new release has been detected, update the cache.
+	cache.SetEntry(c, Entry{
+		Version:    release.Version,
+		Image:      release.Image,
+		Digest:     release.Digest,
+		Source:     source.Name(),
+		Discovered: time.Now().UTC(),
+	})
+}
+
+func channelNames(channels []channel.Channel) []string {
+	names := make([]string, 0, len(channels))
+	for _, c := range channels {
+		names = append(names, string(c))
 	}
 
-	// A new tag has been detected, update the cache.
-	v.Set(c, *found)
+	return names
 }
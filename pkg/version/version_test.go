@@ -0,0 +1,100 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package version
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/talos-systems/talos-controller-manager/pkg/channel"
+)
+
+type fakeSource struct {
+	releases map[channel.Channel]Release
+	err      error
+}
+
+func (s fakeSource) Name() string {
+	return "fake"
+}
+
+func (s fakeSource) Resolve(context.Context, []channel.Channel) (map[channel.Channel]Release, error) {
+	return s.releases, s.err
+}
+
+func TestVersionRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  fakeSource
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "resolved",
+			source: fakeSource{releases: map[channel.Channel]Release{channel.StableChannel: {Version: "v0.4.0"}}},
+			want:   "v0.4.0",
+		},
+		{
+			name:    "failed",
+			source:  fakeSource{err: errors.New("unreachable")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+
+			v := NewVersion(&V1Alpha1{})
+
+			done := make(chan struct{})
+
+			go func() {
+				v.Run(ctx, tt.source, []channel.Channel{channel.StableChannel})
+				close(done)
+			}()
+
+			if !v.WaitForCacheSync(ctx) {
+				t.Fatal("timed out waiting for the cache to sync")
+			}
+
+			if err := v.Err(); (err != nil) != tt.wantErr {
+				t.Errorf("Err() = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got, _ := v.Get(channel.StableChannel); got != tt.want {
+				t.Errorf("Get() = %q, want %q", got, tt.want)
+			}
+
+			cancel()
+
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("Run() did not return once the context was cancelled")
+			}
+		})
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	cm := NewConfigMap(fake.NewFakeClientWithScheme(clientgoscheme.Scheme), "default", ConfigMapName("workers"))
+	cm.SetEntry(channel.StableChannel, Entry{Version: "v0.4.0", Source: "docker.io/autonomy/installer"})
+
+	v := NewVersion(cm)
+
+	// The same version resolved from another source is recorded with it.
+	v.discover(channel.StableChannel, fakeSource{}, Release{Version: "v0.4.0", Digest: "sha256:4ee6ee1e"})
+
+	entry, _ := cm.Entry(channel.StableChannel)
+
+	if entry.Source != "fake" || entry.Digest != "sha256:4ee6ee1e" {
+		t.Errorf("discover() entry = %+v, want the source and digest of the release", entry)
+	}
+}